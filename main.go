@@ -2,21 +2,98 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
 	"github.com/carreter/discord-linkfixer-bot/pkg/linkfixerbot"
 
 	"github.com/charmbracelet/log"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.etcd.io/bbolt"
+	_ "modernc.org/sqlite"
 )
 
+// openStore opens the fixer store of the given type. dsn is a file path for
+// bolt and sqlite stores, a connection string for postgres stores and
+// ignored for memory stores.
+func openStore(storeType string, dsn string) (fixer.Store, error) {
+	switch storeType {
+	case "bolt":
+		db, err := bbolt.Open(dsn, 0600, &bbolt.Options{})
+		if err != nil {
+			return nil, fmt.Errorf("could not open bolt db: %w", err)
+		}
+		return fixer.NewBoltStore(db), nil
+	case "sqlite":
+		db, err := sql.Open("sqlite", fixer.SQLiteDSN(dsn))
+		if err != nil {
+			return nil, fmt.Errorf("could not open sqlite db: %w", err)
+		}
+		// SQLite only allows one writer at a time, so queue writes here
+		// rather than have them wait on each other's locks.
+		db.SetMaxOpenConns(1)
+		return fixer.NewSQLStore(db, "sqlite")
+	case "memory":
+		return fixer.NewMemoryStore(), nil
+	case "postgres":
+		db, err := sql.Open("pgx", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("could not open postgres db: %w", err)
+		}
+		return fixer.NewSQLStore(db, "pgx")
+	default:
+		return nil, fmt.Errorf("unknown store type %v", storeType)
+	}
+}
+
+// loadGlobalFixers replaces the store's global fixers with those in the CSV
+// file at path.
+func loadGlobalFixers(store fixer.Store, path string) error {
+	csv, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fixers, err := fixer.ParseCSV(string(csv))
+	if err != nil {
+		return err
+	}
+
+	err = fixer.SyncGlobalFixers(store, fixers)
+	if err != nil {
+		return err
+	}
+
+	log.Info("loaded global fixers", "numFixers", len(fixers))
+	return nil
+}
+
 func main() {
+	os.Exit(run())
+}
+
+// run runs the bot until it is stopped, and returns the exit code. Deferred
+// cleanup runs before the process exits, whatever the exit code.
+func run() int {
 	authToken := flag.String("token", "", "Discord auth token")
-	boltStore := flag.String("db", "./fixers.db", "path to database")
+	storeType := flag.String("store", "bolt", "store backend: bolt, sqlite, postgres or memory")
+	dsn := flag.String("db", "./fixers.db", "path to database, or connection string for postgres")
+	globalFixers := flag.String("global-fixers", "", "path to a CSV file of fixers that apply in every server")
+	guildRetention := flag.Duration("guild-retention", 30*24*time.Hour, "how long to keep a server's data after the bot leaves it (0 keeps it forever)")
+	operators := flag.String("operators", "", "comma-separated IDs of users allowed to run operator-only commands, besides the application's owners")
+	devGuild := flag.String("dev-guild", "", "register commands only in this server, for development")
+	deleteCommands := flag.Bool("delete-commands", false, "delete the bot's commands on shutdown")
+	messageContent := flag.Bool("message-content", true, "request the privileged Message Content intent, which must also be enabled in the Discord developer portal")
+	shorteners := flag.String("expand-shorteners", strings.Join(fixer.DefaultShortenerDomains, ","), "comma-separated link shortener domains whose links are expanded before fixing (empty to disable)")
+	attachmentDomains := flag.String("attachment-domains", "", "comma-separated CDN domains whose attachment URLs are fixed along with message links")
+	cache := flag.Bool("cache", true, "cache fixers in memory (disable when several instances share a database)")
 
 	log.SetLevel(log.DebugLevel)
 
@@ -24,18 +101,52 @@ func main() {
 
 	if *authToken == "" {
 		log.Error("missing auth token")
-		os.Exit(1)
+		return 1
 	}
 
-	db, err := bbolt.Open(*boltStore, 0600, &bbolt.Options{})
+	store, err := openStore(*storeType, *dsn)
 	if err != nil {
-		log.Error("could not open bolt db", "path", *boltStore, "err", err)
-		os.Exit(1)
+		log.Error("could not open store", "store", *storeType, "err", err)
+		return 1
+	}
+
+	if *cache {
+		cachingStore := fixer.NewCachingStore(store)
+		defer func() {
+			hits, misses := cachingStore.Stats()
+			log.Info("fixer cache stats", "hits", hits, "misses", misses)
+		}()
+		store = cachingStore
+	}
+
+	if *globalFixers != "" {
+		err = loadGlobalFixers(store, *globalFixers)
+		if err != nil {
+			log.Error("could not load global fixers", "path", *globalFixers, "err", err)
+			return 1
+		}
 	}
 
-	bot, err := linkfixerbot.NewLinkfixerBot(*authToken, fixer.NewBoltStore(db))
+	config := linkfixerbot.Config{
+		GuildRetention:           *guildRetention,
+		DevGuildID:               *devGuild,
+		DeleteCommandsOnShutdown: *deleteCommands,
+		MessageContent:           *messageContent,
+	}
+	if *operators != "" {
+		config.OperatorIDs = strings.Split(*operators, ",")
+	}
+	if *shorteners != "" {
+		config.ShortenerDomains = strings.Split(*shorteners, ",")
+	}
+	if *attachmentDomains != "" {
+		config.AttachmentDomains = strings.Split(*attachmentDomains, ",")
+	}
+
+	bot, err := linkfixerbot.NewLinkfixerBot(*authToken, store, config)
 	if err != nil {
 		log.Error("could not create bot", "err", err)
+		return 1
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -52,6 +163,8 @@ func main() {
 	err = bot.Run(ctx)
 	if err != nil {
 		log.Error("bot crashed :(", "err", err)
-		os.Exit(1)
+		return 1
 	}
+
+	return 0
 }
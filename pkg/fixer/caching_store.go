@@ -0,0 +1,253 @@
+package fixer
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"github.com/charmbracelet/log"
+)
+
+// A CachingStore is a read-through cache in front of another Store. It keeps
+// each guild's decoded fixers in memory, with regular expressions and
+// templates already compiled, along with the domains they turn links into
+// and the guild's settings, so that handling incoming messages does not hit
+// the underlying store.
+//
+// A guild's cached fixers and settings are invalidated whenever they are
+// changed through the CachingStore. Changes made to the underlying store by
+// anything else, such as another bot instance sharing a SQL database, are
+// not seen.
+type CachingStore struct {
+	Store
+
+	mu       sync.RWMutex
+	guilds   map[string]*guildCache
+	settings map[string]GuildSettings
+	// gen is incremented on every invalidation, so that data loaded
+	// concurrently with a change is not cached.
+	gen uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// A guildCache holds a guild's cached fixers. A nil fixers map means the
+// guild was not found.
+type guildCache struct {
+	fixers map[string]Fixer
+	// outputs holds the output domains of the fixer for each domain.
+	outputs map[string][]string
+}
+
+func NewCachingStore(store Store) *CachingStore {
+	return &CachingStore{
+		Store:    store,
+		guilds:   map[string]*guildCache{},
+		settings: map[string]GuildSettings{},
+	}
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (cs *CachingStore) Stats() (hits uint64, misses uint64) {
+	return cs.hits.Load(), cs.misses.Load()
+}
+
+// guild returns the guild's cached fixers, loading them from the underlying
+// store if needed.
+func (cs *CachingStore) guild(guildID string) (*guildCache, error) {
+	cs.mu.RLock()
+	gc, ok := cs.guilds[guildID]
+	gen := cs.gen
+	cs.mu.RUnlock()
+	if ok {
+		cs.hits.Add(1)
+		return gc, nil
+	}
+	cs.misses.Add(1)
+
+	fixers, err := cs.Store.List(guildID)
+	if err != nil && !errors.Is(err, ErrGuildNotFound) {
+		return nil, err
+	}
+
+	for domain, f := range fixers {
+		fixers[domain] = compileFixer(f)
+	}
+	gc = &guildCache{fixers: fixers, outputs: outputDomainsOf(fixers)}
+
+	cs.mu.Lock()
+	if cs.gen == gen {
+		cs.guilds[guildID] = gc
+	}
+	cs.mu.Unlock()
+
+	log.Debug("cached guild fixers", "guildID", guildID, "numFixers", len(fixers))
+	return gc, nil
+}
+
+func (cs *CachingStore) invalidate(guildID string) {
+	cs.mu.Lock()
+	delete(cs.guilds, guildID)
+	delete(cs.settings, guildID)
+	cs.gen++
+	cs.mu.Unlock()
+}
+
+func (cs *CachingStore) Put(guildID string, domain string, f Fixer, actorID string) (Change, error) {
+	defer cs.invalidate(guildID)
+	return cs.Store.Put(guildID, domain, uncompileFixer(f), actorID)
+}
+
+func (cs *CachingStore) Get(guildID string, domain string) (Fixer, error) {
+	gc, err := cs.guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+	if gc.fixers == nil {
+		return nil, fmt.Errorf("could not find guild %v: %w", guildID, ErrGuildNotFound)
+	}
+
+	f, ok := gc.fixers[domain]
+	if !ok {
+		return nil, fmt.Errorf("could not find fixer for %v: %w", domain, ErrNotFound)
+	}
+	return f, nil
+}
+
+func (cs *CachingStore) Delete(guildID string, domain string, actorID string) (Change, bool, error) {
+	defer cs.invalidate(guildID)
+	return cs.Store.Delete(guildID, domain, actorID)
+}
+
+func (cs *CachingStore) Undo(c Change, actorID string) (Change, bool, error) {
+	defer cs.invalidate(c.GuildID)
+	c.Old = uncompileFixer(c.Old)
+	return cs.Store.Undo(c, actorID)
+}
+
+func (cs *CachingStore) Purge(guildID string) error {
+	defer cs.invalidate(guildID)
+	return cs.Store.Purge(guildID)
+}
+
+// List returns the guild's fixers, compiled like those returned by Get.
+func (cs *CachingStore) List(guildID string) (map[string]Fixer, error) {
+	gc, err := cs.guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+	if gc.fixers == nil {
+		return nil, fmt.Errorf("could not find guild %v: %w", guildID, ErrGuildNotFound)
+	}
+
+	return maps.Clone(gc.fixers), nil
+}
+
+// outputDomains returns the cached output domains of the fixer for each
+// domain in the guild.
+func (cs *CachingStore) outputDomains(guildID string) (map[string][]string, error) {
+	gc, err := cs.guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+	if gc.fixers == nil {
+		return nil, fmt.Errorf("could not find guild %v: %w", guildID, ErrGuildNotFound)
+	}
+
+	return gc.outputs, nil
+}
+
+func (cs *CachingStore) GetSettings(guildID string) (GuildSettings, error) {
+	cs.mu.RLock()
+	settings, ok := cs.settings[guildID]
+	gen := cs.gen
+	cs.mu.RUnlock()
+	if ok {
+		cs.hits.Add(1)
+		return settings, nil
+	}
+	cs.misses.Add(1)
+
+	settings, err := cs.Store.GetSettings(guildID)
+	if err != nil {
+		return GuildSettings{}, err
+	}
+
+	cs.mu.Lock()
+	if cs.gen == gen {
+		cs.settings[guildID] = settings
+	}
+	cs.mu.Unlock()
+
+	return settings, nil
+}
+
+func (cs *CachingStore) PutSettings(guildID string, settings GuildSettings) error {
+	defer cs.invalidate(guildID)
+	return cs.Store.PutSettings(guildID, settings)
+}
+
+// A compiledRegexpReplaceFixer is a RegexpReplaceFixer whose pattern has
+// already been compiled. It is never stored, only cached.
+type compiledRegexpReplaceFixer struct {
+	RegexpReplaceFixer
+	re *regexp.Regexp
+}
+
+func (f compiledRegexpReplaceFixer) Fix(link string) string {
+	return f.re.ReplaceAllString(link, f.Replacement)
+}
+
+func (f compiledRegexpReplaceFixer) OutputDomains(domain string) []string {
+	return rootOutputDomains(domain, f.Fix)
+}
+
+// compileFixer does any expensive preparation f needs ahead of time.
+func compileFixer(f Fixer) Fixer {
+	switch f := f.(type) {
+	case RegexpReplaceFixer:
+		re, err := regexp.Compile(f.Pattern)
+		if err != nil {
+			// Leave it to RegexpReplaceFixer.Fix to report the error.
+			return f
+		}
+		return compiledRegexpReplaceFixer{RegexpReplaceFixer: f, re: re}
+	case TemplateFixer:
+		cf, err := f.compile()
+		if err != nil {
+			// Leave it to TemplateFixer.Fix to report the error.
+			return f
+		}
+		return cf
+	case FallbackFixer:
+		return FallbackFixer{Fixers: mapFixers(f.Fixers, compileFixer)}
+	default:
+		return f
+	}
+}
+
+// uncompileFixer undoes compileFixer so f can be stored.
+func uncompileFixer(f Fixer) Fixer {
+	switch f := f.(type) {
+	case compiledRegexpReplaceFixer:
+		return f.RegexpReplaceFixer
+	case compiledTemplateFixer:
+		return f.TemplateFixer
+	case FallbackFixer:
+		return FallbackFixer{Fixers: mapFixers(f.Fixers, uncompileFixer)}
+	default:
+		return f
+	}
+}
+
+func mapFixers(fixers []Fixer, fn func(Fixer) Fixer) []Fixer {
+	res := make([]Fixer, len(fixers))
+	for n, f := range fixers {
+		res[n] = fn(f)
+	}
+	return res
+}
@@ -0,0 +1,142 @@
+package fixer_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer/storetest"
+	"go.etcd.io/bbolt"
+)
+
+func TestCachingStore(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) fixer.Store {
+			return fixer.NewCachingStore(fixer.NewMemoryStore())
+		})
+	})
+	t.Run("Bolt", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) fixer.Store {
+			return fixer.NewCachingStore(newBoltStore(t))
+		})
+	})
+}
+
+func TestCachingStoreCachesSettingsAndCompiledFixers(t *testing.T) {
+	cs := fixer.NewCachingStore(fixer.NewMemoryStore())
+
+	err := cs.PutSettings(guildID, fixer.GuildSettings{KeepQueryParams: true})
+	if err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+	for range 3 {
+		settings, err := cs.GetSettings(guildID)
+		if err != nil {
+			t.Fatalf("GetSettings failed: %v", err)
+		}
+		if !settings.KeepQueryParams {
+			t.Errorf("GetSettings = %+v, want KeepQueryParams", settings)
+		}
+	}
+	if hits, misses := cs.Stats(); hits != 2 || misses != 1 {
+		t.Errorf("Stats = %v hits, %v misses, want 2 hits, 1 miss", hits, misses)
+	}
+
+	err = cs.PutSettings(guildID, fixer.GuildSettings{})
+	if err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+	settings, err := cs.GetSettings(guildID)
+	if err != nil {
+		t.Fatalf("GetSettings failed: %v", err)
+	}
+	if settings.KeepQueryParams {
+		t.Errorf("GetSettings after PutSettings returned the cached settings %+v", settings)
+	}
+
+	want := fixer.RegexpReplaceFixer{Pattern: `(www\.)?reddit\.com`, Replacement: "old.reddit.com"}
+	_, err = cs.Put(guildID, "reddit.com", want, actorID)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	got, err := cs.Get(guildID, "reddit.com")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	listed, err := cs.List(guildID)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if _, ok := got.(fixer.RegexpReplaceFixer); ok {
+		t.Errorf("Get returned an uncompiled fixer")
+	}
+	if _, ok := listed["reddit.com"].(fixer.RegexpReplaceFixer); ok {
+		t.Errorf("List returned an uncompiled fixer")
+	}
+	if !fixer.EqualFixers(listed["reddit.com"], want) {
+		t.Errorf("List()[reddit.com] = %v, want %v", listed["reddit.com"], want)
+	}
+}
+
+// benchmarkMessage is a message with a link for each kind of fixer, and one
+// without a fixer.
+const benchmarkMessage = `look at https://twitter.com/user/status/1?s=20 and
+https://www.reddit.com/r/golang/comments/abc and https://youtube.com/watch?v=abc123
+and https://tiktok.com/@user/video/1, or https://example.com/unfixed`
+
+// BenchmarkFixLinks measures fixing the links in a message with fixers
+// stored in Bolt, with and without a CachingStore in front.
+func BenchmarkFixLinks(b *testing.B) {
+	for name, cached := range map[string]bool{"Uncached": false, "Cached": true} {
+		b.Run(name, func(b *testing.B) {
+			db, err := bbolt.Open(filepath.Join(b.TempDir(), "fixers.db"), 0600, &bbolt.Options{})
+			if err != nil {
+				b.Fatalf("could not open bolt db: %v", err)
+			}
+			defer db.Close()
+
+			var s fixer.Store = fixer.NewBoltStore(db)
+			if cached {
+				s = fixer.NewCachingStore(s)
+			}
+
+			fixers := map[string]fixer.Fixer{
+				"twitter.com": fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"},
+				"reddit.com":  fixer.RegexpReplaceFixer{Pattern: `(www\.)?reddit\.com`, Replacement: "old.reddit.com"},
+				"youtube.com": fixer.TemplateFixer{Template: `https://yewtu.be/watch?v={{.Query.Get "v"}}`},
+				"tiktok.com":  fixer.PrependFixer{Prefix: "https://proxy.example/"},
+			}
+			for domain, f := range fixers {
+				_, err = s.Put(guildID, domain, f, actorID)
+				if err != nil {
+					b.Fatalf("Put failed: %v", err)
+				}
+			}
+			// Fill the global scope with unrelated fixers, as they are all
+			// considered for every message.
+			for n := range 100 {
+				domain := fmt.Sprintf("example%v.com", n)
+				_, err = s.Put(fixer.GlobalScope, domain, fixer.RegexpReplaceFixer{Pattern: `example\d+\.com`, Replacement: "fixed.example"}, actorID)
+				if err != nil {
+					b.Fatalf("Put failed: %v", err)
+				}
+			}
+
+			b.ResetTimer()
+			for range b.N {
+				settings, err := s.GetSettings(guildID)
+				if err != nil {
+					b.Fatalf("GetSettings failed: %v", err)
+				}
+				fixes, err := fixer.FixLinks(s, guildID, benchmarkMessage, settings)
+				if err != nil {
+					b.Fatalf("FixLinks failed: %v", err)
+				}
+				if len(fixes) != 4 {
+					b.Fatalf("got %v fixes, want 4", len(fixes))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package fixer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ParseCSV parses fixers from CSV text, one per row, keyed by domain.
+//
+// Rows have one of the formats
+//
+//	prepend,<domain>,<prefix>
+//	replace,<domain>,<old>,<new>
+//	regex,<domain>,<pattern>,<replacement>
+//	mirror,<domain>,<strategy>,<instance>...
+//	template,<domain>,<template>[,<pattern>]
+//	fallback,<domain>,<type>,<params>...
+//
+// A fallback row adds a fallback, in any of the other formats without the
+// domain, to the fixer for its domain on an earlier row.
+//
+// Fields containing commas or quotes must be quoted. Blank lines are ignored.
+func ParseCSV(text string) (map[string]Fixer, error) {
+	r := csv.NewReader(strings.NewReader(text))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.LazyQuotes = true
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	fixers := make(map[string]Fixer)
+	for _, cols := range rows {
+		for n := range cols {
+			cols[n] = strings.TrimSpace(cols[n])
+		}
+		line := strings.Join(cols, ",")
+
+		if len(cols) < 2 {
+			return nil, fmt.Errorf("invalid fixer format (should be '<type>,<domain>,<params>...'): %v", line)
+		}
+
+		domain := ExtractDomain(cols[1])
+		if domain == "" {
+			return nil, fmt.Errorf("invalid domain: %s", cols[1])
+		}
+
+		if cols[0] == "fallback" {
+			if len(cols) < 3 {
+				return nil, fmt.Errorf("invalid fallback format (should be 'fallback,<domain>,<type>,<params>...'): %v", line)
+			}
+			primary, ok := fixers[domain]
+			if !ok {
+				return nil, fmt.Errorf("fallback for %v before its fixer: %v", domain, line)
+			}
+			fallback, err := NewFixer(cols[2], cols[3:])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", err, line)
+			}
+			fixers[domain] = WithFallback(primary, fallback)
+			continue
+		}
+
+		newFixer, err := NewFixer(cols[0], cols[2:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", err, line)
+		}
+		fixers[domain] = newFixer
+	}
+	return fixers, nil
+}
+
+// FormatCSV formats fixers in the format read by ParseCSV, sorted by domain.
+func FormatCSV(fixers map[string]Fixer) (string, error) {
+	domains := make([]string, 0, len(fixers))
+	for domain := range fixers {
+		domains = append(domains, domain)
+	}
+	slices.Sort(domains)
+
+	b := bytes.Buffer{}
+	w := csv.NewWriter(&b)
+	for _, domain := range domains {
+		f := uncompileFixer(fixers[domain])
+
+		var rows [][]string
+		if ff, ok := f.(FallbackFixer); ok {
+			for n, fallback := range ff.Fixers {
+				row, err := csvRow(domain, fallback)
+				if err != nil {
+					return "", err
+				}
+				if n > 0 {
+					row = append([]string{"fallback"}, row...)
+					row[1], row[2] = row[2], row[1]
+				}
+				rows = append(rows, row)
+			}
+		} else {
+			row, err := csvRow(domain, f)
+			if err != nil {
+				return "", err
+			}
+			rows = append(rows, row)
+		}
+
+		err := w.WriteAll(rows)
+		if err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+
+	return b.String(), w.Error()
+}
+
+// csvRow formats a fixer that is not a FallbackFixer as a ParseCSV row.
+func csvRow(domain string, f Fixer) ([]string, error) {
+	switch f := uncompileFixer(f).(type) {
+	case PrependFixer:
+		return []string{"prepend", domain, f.Prefix}, nil
+	case ReplaceFixer:
+		return []string{"replace", domain, f.Old, f.New}, nil
+	case RegexpReplaceFixer:
+		return []string{"regex", domain, f.Pattern, f.Replacement}, nil
+	case MirrorFixer:
+		return append([]string{"mirror", domain, string(f.Strategy)}, f.Instances...), nil
+	case TemplateFixer:
+		if f.Pattern == "" {
+			return []string{"template", domain, f.Template}, nil
+		}
+		return []string{"template", domain, f.Template, f.Pattern}, nil
+	default:
+		return nil, fmt.Errorf("fixer for %v cannot be exported to CSV: %v", domain, f)
+	}
+}
+
+// ParseFixer parses a single fixer from a CSV row without the domain, e.g.
+// "replace,<old>,<new>".
+func ParseFixer(row string) (Fixer, error) {
+	r := csv.NewReader(strings.NewReader(row))
+	r.TrimLeadingSpace = true
+	r.LazyQuotes = true
+
+	cols, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	for n := range cols {
+		cols[n] = strings.TrimSpace(cols[n])
+	}
+	return NewFixer(cols[0], cols[1:])
+}
@@ -0,0 +1,76 @@
+package fixer
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/charmbracelet/log"
+)
+
+func encodeFixer(f Fixer) ([]byte, error) {
+	b := bytes.Buffer{}
+	err := gob.NewEncoder(&b).Encode(&f)
+	if err != nil {
+		log.Error("could not encode fixer", "fixer", f, "err", err)
+		return nil, err
+	}
+
+	log.Debug("encoded fixer", "encoded", b.Bytes())
+
+	return b.Bytes(), nil
+}
+
+func decodeFixer(b []byte) (Fixer, error) {
+	var f Fixer
+	err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(&f)
+	if err != nil {
+		log.Error("could not decode fixer", "err", err)
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func encodeChange(c Change) ([]byte, error) {
+	b := bytes.Buffer{}
+	err := gob.NewEncoder(&b).Encode(&c)
+	if err != nil {
+		log.Error("could not encode change", "change", c, "err", err)
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func decodeChange(b []byte) (Change, error) {
+	var c Change
+	err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(&c)
+	if err != nil {
+		log.Error("could not decode change", "err", err)
+		return Change{}, err
+	}
+
+	return c, nil
+}
+
+func encodeSettings(s GuildSettings) ([]byte, error) {
+	b := bytes.Buffer{}
+	err := gob.NewEncoder(&b).Encode(&s)
+	if err != nil {
+		log.Error("could not encode settings", "settings", s, "err", err)
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func decodeSettings(b []byte) (GuildSettings, error) {
+	var s GuildSettings
+	err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(&s)
+	if err != nil {
+		log.Error("could not decode settings", "err", err)
+		return GuildSettings{}, err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,16 @@
+package fixer
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when a requested fixer does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrGuildNotFound is returned when a guild has never had any fixers.
+	// It wraps ErrNotFound, so callers that only care whether a fixer
+	// exists can check for ErrNotFound alone.
+	ErrGuildNotFound = fmt.Errorf("guild %w", ErrNotFound)
+)
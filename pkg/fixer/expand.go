@@ -0,0 +1,209 @@
+package fixer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// DefaultShortenerDomains are link shortener domains whose links are
+// commonly posted with fixable destinations.
+var DefaultShortenerDomains = []string{
+	"t.co",
+	"bit.ly",
+	"vm.tiktok.com",
+	"vt.tiktok.com",
+	"redd.it",
+	"youtu.be",
+	"b23.tv",
+}
+
+// Defaults for the limits of an Expander.
+const (
+	DefaultExpandTimeout     = 3 * time.Second
+	DefaultExpandMaxHops     = 5
+	DefaultExpandMaxBodySize = 64 << 10
+	DefaultExpandCacheTTL    = time.Hour
+
+	// expandCacheSize is the number of links an Expander caches before its
+	// cache is cleared.
+	expandCacheSize = 10000
+)
+
+// An Expander resolves links on link shortener domains to the links they
+// redirect to, so that the destination's fixer can be looked up.
+//
+// Only links on the allowlisted shortener domains are ever requested: a
+// redirect to any other domain is taken to be the destination and is not
+// followed further.
+type Expander struct {
+	// Domains are the shortener domains whose links are expanded.
+	Domains []string
+	// Client makes the requests. It must not follow redirects itself.
+	Client *http.Client
+	// Timeout bounds the time spent expanding a single link.
+	Timeout time.Duration
+	// MaxHops is the maximum number of redirects followed for a link.
+	MaxHops int
+	// MaxBodySize is the most of each response body that is read.
+	MaxBodySize int64
+	// CacheTTL is how long expanded links, and links that could not be
+	// expanded, are cached.
+	CacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]expansion
+	now   func() time.Time
+}
+
+// An expansion is a cached result of expanding a link.
+type expansion struct {
+	link    string
+	expires time.Time
+}
+
+// NewExpander returns an Expander for links on domains with the default
+// limits.
+func NewExpander(domains []string) *Expander {
+	return &Expander{
+		Domains: domains,
+		Client: &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Timeout:     DefaultExpandTimeout,
+		MaxHops:     DefaultExpandMaxHops,
+		MaxBodySize: DefaultExpandMaxBodySize,
+		CacheTTL:    DefaultExpandCacheTTL,
+		cache:       map[string]expansion{},
+		now:         time.Now,
+	}
+}
+
+// isShortener reports whether link is on one of e's shortener domains.
+func (e *Expander) isShortener(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(e.Domains, strings.TrimPrefix(u.Hostname(), "www."))
+}
+
+// ExpandLinks returns text with every shortened link in it replaced by the
+// link it redirects to. Links that cannot be expanded are left as they are.
+// A nil Expander returns text unchanged.
+func (e *Expander) ExpandLinks(ctx context.Context, text string) string {
+	if e == nil {
+		return text
+	}
+
+	for _, link := range ExtractURLs(text) {
+		if !e.isShortener(link) {
+			continue
+		}
+
+		expanded := e.cached(link)
+		if expanded == "" {
+			var err error
+			expanded, err = e.Expand(ctx, link)
+			if err != nil {
+				log.Warn("could not expand link", "link", link, "err", err)
+				expanded = link
+			}
+			e.store(link, expanded)
+		}
+
+		text = strings.Replace(text, link, expanded, 1)
+	}
+	return text
+}
+
+func (e *Expander) cached(link string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	c, ok := e.cache[link]
+	if !ok || !e.now().Before(c.expires) {
+		return ""
+	}
+	return c.link
+}
+
+func (e *Expander) store(link string, expanded string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.cache) >= expandCacheSize {
+		clear(e.cache)
+	}
+	e.cache[link] = expansion{link: expanded, expires: e.now().Add(e.CacheTTL)}
+}
+
+// Expand follows the redirects from link, as long as they stay on shortener
+// domains, and returns where they lead. It does not use the cache.
+func (e *Expander) Expand(ctx context.Context, link string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+
+	for range e.MaxHops {
+		if !e.isShortener(link) {
+			return link, nil
+		}
+
+		next, err := e.follow(ctx, link)
+		if err != nil {
+			return "", err
+		}
+		if next == "" {
+			// Not a redirect, so the shortener itself is the destination.
+			return link, nil
+		}
+		link = next
+	}
+
+	if e.isShortener(link) {
+		return "", fmt.Errorf("too many redirects (more than %v)", e.MaxHops)
+	}
+	return link, nil
+}
+
+// follow requests link and returns the absolute URL it redirects to, or ""
+// if it does not redirect.
+func (e *Expander) follow(ctx context.Context, link string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Drain what we allow of the body, so the connection can be reused.
+	_, err = io.Copy(io.Discard, io.LimitReader(resp.Body, e.MaxBodySize))
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return "", fmt.Errorf("could not read response: %w", err)
+	}
+
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return "", nil
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("redirect with no location: %w", err)
+	}
+	return location.String(), nil
+}
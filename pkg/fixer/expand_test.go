@@ -0,0 +1,119 @@
+package fixer_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// newShortener starts a server that redirects each path in redirects to its
+// location, and counts the requests it gets.
+func newShortener(t *testing.T, redirects map[string]string) (*httptest.Server, *atomic.Int64) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		location, ok := redirects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, location, http.StatusMovedPermanently)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestExpanderFollowsRedirects(t *testing.T) {
+	// The shortener redirects to itself once before reaching the
+	// destination, which is not requested as it is not a shortener.
+	var destRequests atomic.Int64
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		destRequests.Add(1)
+	}))
+	t.Cleanup(dest.Close)
+	u, err := url.Parse(dest.URL)
+	if err != nil {
+		t.Fatalf("could not parse server URL: %v", err)
+	}
+	destLink := "http://localhost:" + u.Port() + "/status/1"
+
+	srv, requests := newShortener(t, map[string]string{
+		"/a": "/b",
+		"/b": destLink,
+	})
+	e := fixer.NewExpander([]string{"127.0.0.1"})
+
+	got := e.ExpandLinks(context.Background(), "look at "+srv.URL+"/a please")
+	if want := "look at " + destLink + " please"; got != want {
+		t.Errorf("ExpandLinks = %q, want %q", got, want)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("shortener got %v requests, want 2", n)
+	}
+	if n := destRequests.Load(); n != 0 {
+		t.Errorf("destination got %v requests, want 0", n)
+	}
+
+	// Expanded links are cached.
+	got = e.ExpandLinks(context.Background(), srv.URL+"/a")
+	if got != destLink {
+		t.Errorf("ExpandLinks = %q, want %q", got, destLink)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("shortener got %v requests after a cached expansion, want 2", n)
+	}
+}
+
+func TestExpanderStopsAfterMaxHops(t *testing.T) {
+	srv, requests := newShortener(t, map[string]string{"/loop": "/loop"})
+	e := fixer.NewExpander([]string{"127.0.0.1"})
+	e.MaxHops = 3
+
+	_, err := e.Expand(context.Background(), srv.URL+"/loop")
+	if err == nil {
+		t.Errorf("Expand of a redirect loop succeeded")
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("shortener got %v requests, want 3", n)
+	}
+
+	// Links that cannot be expanded are left as they are.
+	text := "see " + srv.URL + "/loop"
+	if got := e.ExpandLinks(context.Background(), text); got != text {
+		t.Errorf("ExpandLinks = %q, want %q", got, text)
+	}
+}
+
+func TestExpanderOnlyRequestsShorteners(t *testing.T) {
+	srv, requests := newShortener(t, map[string]string{"/a": "https://example.com/"})
+	e := fixer.NewExpander([]string{"t.co"})
+
+	text := "see " + srv.URL + "/a"
+	if got := e.ExpandLinks(context.Background(), text); got != text {
+		t.Errorf("ExpandLinks = %q, want %q", got, text)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("non-shortener got %v requests, want 0", n)
+	}
+}
+
+func TestExpanderUsesContext(t *testing.T) {
+	srv, requests := newShortener(t, map[string]string{"/a": "https://example.com/"})
+	e := fixer.NewExpander([]string{"127.0.0.1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	text := srv.URL + "/a"
+	if got := e.ExpandLinks(ctx, text); got != text {
+		t.Errorf("ExpandLinks with a cancelled context = %q, want %q", got, text)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("shortener got %v requests with a cancelled context, want 0", n)
+	}
+}
@@ -3,7 +3,9 @@ package fixer
 import (
 	"encoding/gob"
 	"fmt"
+	"reflect"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/charmbracelet/log"
@@ -14,6 +16,9 @@ func init() {
 	gob.Register(ReplaceFixer{})
 	gob.Register(RegexpReplaceFixer{})
 	gob.Register(PrependFixer{})
+	gob.Register(FallbackFixer{})
+	gob.Register(MirrorFixer{})
+	gob.Register(TemplateFixer{})
 }
 
 // A Fixer fixes an input URL and returns a corrected copy.
@@ -22,6 +27,43 @@ type Fixer interface {
 	Fix(string) string
 }
 
+// A FixedChecker is a Fixer that can tell when a link is already in the form
+// it fixes links into, so that fixing it again would mangle it, e.g. by
+// prepending the same prefix twice.
+type FixedChecker interface {
+	Fixer
+	IsFixed(link string) bool
+}
+
+// An OutputDomainer is a Fixer that can tell which domains it turns links on
+// domain into, without fixing any links. Every built-in Fixer is one.
+type OutputDomainer interface {
+	Fixer
+	OutputDomains(domain string) []string
+}
+
+// An AlternativesFixer is a Fixer with several ways of fixing a link, which
+// are tried in order when fixed links are checked to be up. Fix uses the
+// first alternative.
+type AlternativesFixer interface {
+	Fixer
+	Alternatives() []Fixer
+}
+
+// A QueryFixer is a Fixer that reads the query of the links it fixes, and
+// decides itself what query its fixed links keep. Links are passed to it
+// with their query even if GuildSettings.KeepQueryParams is not set.
+type QueryFixer interface {
+	Fixer
+	UsesQuery() bool
+}
+
+// EqualFixers reports whether a and b fix links the same way, ignoring
+// anything a CachingStore prepared ahead of time.
+func EqualFixers(a Fixer, b Fixer) bool {
+	return reflect.DeepEqual(uncompileFixer(a), uncompileFixer(b))
+}
+
 // A ReplaceFixer performs simple replacement on its URL.
 type ReplaceFixer struct {
 	Old string
@@ -33,6 +75,18 @@ func (f ReplaceFixer) Fix(link string) string {
 	return strings.ReplaceAll(link, f.Old, f.New)
 }
 
+// IsFixed reports whether link already contains f.New when f.New contains
+// f.Old, in which case replacing f.Old again would mangle it, e.g. turning
+// fxtwitter.com into fxfxtwitter.com.
+func (f ReplaceFixer) IsFixed(link string) bool {
+	return f.Old != "" && strings.Contains(f.New, f.Old) && strings.Contains(link, f.New)
+}
+
+// OutputDomains returns the domain of domain's root link after replacement.
+func (f ReplaceFixer) OutputDomains(domain string) []string {
+	return rootOutputDomains(domain, f.Fix)
+}
+
 func (f ReplaceFixer) String() string {
 	return fmt.Sprintf("replace '%v' with '%v'", f.Old, f.New)
 }
@@ -58,6 +112,11 @@ func (f RegexpReplaceFixer) Fix(link string) string {
 	return re.ReplaceAllString(link, f.Replacement)
 }
 
+// OutputDomains returns the domain of domain's root link after replacement.
+func (f RegexpReplaceFixer) OutputDomains(domain string) []string {
+	return rootOutputDomains(domain, f.Fix)
+}
+
 func (f RegexpReplaceFixer) String() string {
 	return fmt.Sprintf("regex replace '%v' with '%v'", f.Pattern, f.Replacement)
 }
@@ -73,3 +132,105 @@ func (f PrependFixer) String() string {
 func (f PrependFixer) Fix(link string) string {
 	return f.Prefix + link
 }
+
+// IsFixed reports whether link already starts with f.Prefix.
+func (f PrependFixer) IsFixed(link string) bool {
+	return strings.HasPrefix(link, f.Prefix)
+}
+
+// OutputDomains returns the domain of f.Prefix, which is where every fixed
+// link points, or none if f.Prefix is not a URL.
+func (f PrependFixer) OutputDomains(domain string) []string {
+	if !strings.HasPrefix(f.Prefix, "http://") && !strings.HasPrefix(f.Prefix, "https://") {
+		return nil
+	}
+	return []string{ExtractDomain(f.Prefix)}
+}
+
+// A FallbackFixer fixes links with the first of its fixers, falling back to
+// the next ones when fixed links are checked and the first is down.
+type FallbackFixer struct {
+	Fixers []Fixer
+}
+
+func (f FallbackFixer) Fix(link string) string {
+	if len(f.Fixers) == 0 {
+		return link
+	}
+	return f.Fixers[0].Fix(link)
+}
+
+func (f FallbackFixer) Alternatives() []Fixer {
+	return f.Fixers
+}
+
+// OutputDomains returns the output domains of all of f's fixers.
+func (f FallbackFixer) OutputDomains(domain string) []string {
+	var res []string
+	for _, ff := range f.Fixers {
+		res = append(res, FixerOutputDomains(domain, ff)...)
+	}
+	return res
+}
+
+func (f FallbackFixer) String() string {
+	var fixers []string
+	for _, fixer := range f.Fixers {
+		fixers = append(fixers, fixer.String())
+	}
+	return strings.Join(fixers, ", falling back to ")
+}
+
+// WithFallback returns a FallbackFixer that tries f, then fallback. If f is
+// already a FallbackFixer, fallback is added after its fixers.
+func WithFallback(f Fixer, fallback Fixer) FallbackFixer {
+	if ff, ok := f.(FallbackFixer); ok {
+		return FallbackFixer{Fixers: append(slices.Clone(ff.Fixers), fallback)}
+	}
+	return FallbackFixer{Fixers: []Fixer{f, fallback}}
+}
+
+// FixerTypes lists the fixer types accepted by NewFixer.
+var FixerTypes = []string{"prepend", "replace", "regex", "mirror", "template"}
+
+// NewFixer builds a fixer of the named type from its parameters, which are
+// in the order they appear in ParseCSV rows.
+func NewFixer(fixerType string, params []string) (Fixer, error) {
+	switch fixerType {
+	case "prepend":
+		if len(params) != 1 {
+			return nil, fmt.Errorf("prepend fixers take 1 parameter (prefix), got %v", len(params))
+		}
+		return PrependFixer{Prefix: params[0]}, nil
+	case "replace":
+		if len(params) != 2 {
+			return nil, fmt.Errorf("replace fixers take 2 parameters (old, new), got %v", len(params))
+		}
+		return ReplaceFixer{Old: params[0], New: params[1]}, nil
+	case "regex":
+		if len(params) != 2 {
+			return nil, fmt.Errorf("regex fixers take 2 parameters (pattern, replacement), got %v", len(params))
+		}
+		_, err := regexp.Compile(params[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", params[0], err)
+		}
+		return RegexpReplaceFixer{Pattern: params[0], Replacement: params[1]}, nil
+	case "mirror":
+		if len(params) < 2 {
+			return nil, fmt.Errorf("mirror fixers take 2 or more parameters (strategy, instances...), got %v", len(params))
+		}
+		return NewMirrorFixer(MirrorStrategy(params[0]), params[1:])
+	case "template":
+		if len(params) != 1 && len(params) != 2 {
+			return nil, fmt.Errorf("template fixers take 1 or 2 parameters (template, pattern), got %v", len(params))
+		}
+		pattern := ""
+		if len(params) == 2 {
+			pattern = params[1]
+		}
+		return NewTemplateFixer(params[0], pattern)
+	default:
+		return nil, fmt.Errorf("unknown fixer type: %s", fixerType)
+	}
+}
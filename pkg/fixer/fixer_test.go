@@ -0,0 +1,119 @@
+package fixer_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+func TestIsFixed(t *testing.T) {
+	mirror, err := fixer.NewMirrorFixer(fixer.MirrorFirstHealthy, []string{"yewtu.be", "inv.nadeko.net"})
+	if err != nil {
+		t.Fatalf("NewMirrorFixer failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		fixer fixer.FixedChecker
+		link  string
+		want  bool
+	}{
+		{"ReplaceContainingOld", fixer.ReplaceFixer{Old: "twitter.com", New: "fxtwitter.com"}, "https://fxtwitter.com/a/status/1", true},
+		{"ReplaceContainingOldUnfixed", fixer.ReplaceFixer{Old: "twitter.com", New: "fxtwitter.com"}, "https://twitter.com/a/status/1", false},
+		// Replacing again is harmless when New does not contain Old.
+		{"ReplaceNotContainingOld", fixer.ReplaceFixer{Old: "twitter.com", New: "nitter.net"}, "https://nitter.net/a/status/1", false},
+		{"ReplaceEmptyOld", fixer.ReplaceFixer{Old: "", New: "a"}, "https://a.example/", false},
+		{"Prepend", fixer.PrependFixer{Prefix: "https://proxy.example/"}, "https://proxy.example/https://tiktok.com/@a", true},
+		{"PrependUnfixed", fixer.PrependFixer{Prefix: "https://proxy.example/"}, "https://tiktok.com/@a", false},
+		{"Mirror", mirror, "https://inv.nadeko.net/watch?v=1", true},
+		{"MirrorUnfixed", mirror, "https://youtube.com/watch?v=1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fixer.IsFixed(tt.link); got != tt.want {
+				t.Errorf("IsFixed(%q) = %v, want %v", tt.link, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixerOutputDomains(t *testing.T) {
+	tests := []struct {
+		name   string
+		domain string
+		fixer  fixer.Fixer
+		want   []string
+	}{
+		{"Replace", "twitter.com", fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"}, []string{"vxtwitter.com"}},
+		{"Regexp", "reddit.com", fixer.RegexpReplaceFixer{Pattern: `(www\.)?reddit\.com`, Replacement: "old.reddit.com"}, []string{"old.reddit.com"}},
+		{"Prepend", "tiktok.com", fixer.PrependFixer{Prefix: "https://proxy.example/"}, []string{"proxy.example"}},
+		{"PrependNotURL", "tiktok.com", fixer.PrependFixer{Prefix: "see: "}, nil},
+		{"Mirror", "youtube.com", fixer.MirrorFixer{Instances: []string{"yewtu.be", "inv.nadeko.net"}, Strategy: fixer.MirrorRandom}, []string{"yewtu.be", "inv.nadeko.net"}},
+		{"Template", "x.com", fixer.TemplateFixer{Template: "https://fixupx.com{{.Path}}"}, []string{"fixupx.com"}},
+		{"Fallback", "x.com", fixer.FallbackFixer{Fixers: []fixer.Fixer{
+			fixer.TemplateFixer{Template: "https://fixupx.com{{.Path}}"},
+			fixer.ReplaceFixer{Old: "x.com", New: "fxtwitter.com"},
+		}}, []string{"fixupx.com", "fxtwitter.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fixer.FixerOutputDomains(tt.domain, tt.fixer)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FixerOutputDomains(%q) = %v, want %v", tt.domain, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixLinksDoesNotRefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		domain string
+		fixer  fixer.Fixer
+		link   string
+	}{
+		{"Replace", "twitter.com", fixer.ReplaceFixer{Old: "twitter.com", New: "fxtwitter.com"}, "https://twitter.com/a/status/1"},
+		{"Regexp", "reddit.com", fixer.RegexpReplaceFixer{Pattern: `(www\.)?reddit\.com`, Replacement: "old.reddit.com"}, "https://www.reddit.com/r/golang"},
+		{"Prepend", "tiktok.com", fixer.PrependFixer{Prefix: "https://proxy.example/"}, "https://tiktok.com/@a/video/1"},
+		// The prefix is on the fixer's own domain, so only IsFixed stops
+		// the prefix being prepended twice.
+		{"PrependSameDomain", "archive.example", fixer.PrependFixer{Prefix: "https://archive.example/newest/"}, "https://archive.example/page"},
+		{"Mirror", "youtube.com", fixer.MirrorFixer{Instances: []string{"yewtu.be", "inv.nadeko.net"}, Strategy: fixer.MirrorRandom}, "https://youtube.com/watch"},
+		{"Template", "x.com", fixer.TemplateFixer{Template: "https://fixupx.com{{.Path}}"}, "https://x.com/a/status/1"},
+		{"Fallback", "instagram.com", fixer.FallbackFixer{Fixers: []fixer.Fixer{
+			fixer.ReplaceFixer{Old: "instagram.com", New: "ddinstagram.com"},
+			fixer.ReplaceFixer{Old: "instagram.com", New: "instagramez.com"},
+		}}, "https://instagram.com/p/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fixer.NewMemoryStore()
+			_, err := s.Put(guildID, tt.domain, tt.fixer, actorID)
+			if err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+
+			fixes, err := fixer.FixLinks(s, guildID, tt.link, fixer.GuildSettings{})
+			if err != nil {
+				t.Fatalf("FixLinks failed: %v", err)
+			}
+			if len(fixes) != 1 {
+				t.Fatalf("FixLinks(%q) = %v, want 1 fix", tt.link, fixes)
+			}
+
+			// Posting the fixed link again does not fix it again.
+			fixed := fixes[0].Fixed
+			fixes, err = fixer.FixLinks(s, guildID, fixed, fixer.GuildSettings{})
+			if err != nil {
+				t.Fatalf("FixLinks failed: %v", err)
+			}
+			if len(fixes) != 0 {
+				t.Errorf("FixLinks(%q) = %v, want no fixes", fixed, fixes)
+			}
+		})
+	}
+}
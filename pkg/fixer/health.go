@@ -0,0 +1,175 @@
+package fixer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Defaults for the limits of a HealthChecker.
+const (
+	DefaultHealthCheckTimeout  = 2 * time.Second
+	DefaultHealthCheckCacheTTL = 5 * time.Minute
+
+	// healthCheckMaxBodySize is the most of a GET response body that is
+	// read when checking health.
+	healthCheckMaxBodySize = 16 << 10
+)
+
+// A HealthChecker checks whether the hosts fixed links point to are up, so
+// that dead links are not posted. Results are cached per host.
+type HealthChecker struct {
+	// Client makes the requests.
+	Client *http.Client
+	// Timeout bounds the time spent checking a single host.
+	Timeout time.Duration
+	// CacheTTL is how long a host's health is cached.
+	CacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]hostHealth
+	now   func() time.Time
+}
+
+// A hostHealth is a cached result of checking a host.
+type hostHealth struct {
+	healthy bool
+	expires time.Time
+}
+
+// NewHealthChecker returns a HealthChecker with the default limits.
+func NewHealthChecker() *HealthChecker {
+	return &HealthChecker{
+		Client:   &http.Client{},
+		Timeout:  DefaultHealthCheckTimeout,
+		CacheTTL: DefaultHealthCheckCacheTTL,
+		cache:    map[string]hostHealth{},
+		now:      time.Now,
+	}
+}
+
+// Healthy reports whether the host of link is up. Hosts are up if they
+// respond to link without a server error. Only the first link checked on
+// each host is requested until its result expires.
+func (hc *HealthChecker) Healthy(ctx context.Context, link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+
+	hc.mu.Lock()
+	cached, ok := hc.cache[u.Host]
+	hc.mu.Unlock()
+	if ok && hc.now().Before(cached.expires) {
+		return cached.healthy
+	}
+
+	healthy := hc.check(ctx, link)
+
+	hc.mu.Lock()
+	hc.cache[u.Host] = hostHealth{healthy: healthy, expires: hc.now().Add(hc.CacheTTL)}
+	hc.mu.Unlock()
+
+	if !healthy {
+		log.Info("host is down", "host", u.Host)
+	}
+	return healthy
+}
+
+// check requests link with a HEAD request, falling back to GET for servers
+// that do not support HEAD.
+func (hc *HealthChecker) check(ctx context.Context, link string) bool {
+	ctx, cancel := context.WithTimeout(ctx, hc.Timeout)
+	defer cancel()
+
+	status, err := hc.request(ctx, http.MethodHead, link)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = hc.request(ctx, http.MethodGet, link)
+	}
+	if err != nil {
+		log.Debug("health check failed", "link", link, "err", err)
+		return false
+	}
+	return status < 500
+}
+
+func (hc *HealthChecker) request(ctx context.Context, method string, link string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := hc.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, healthCheckMaxBodySize))
+	return resp.StatusCode, nil
+}
+
+// CheckFixes replaces each fix whose fixed link is down with the first of
+// its fixer's alternatives that is up, if it is an AlternativesFixer, and
+// drops it if there is none.
+//
+// Fixes are only checked if settings.CheckLinks is set, or their fixer is a
+// MirrorFixer using MirrorFirstHealthy, on its own or as the first fixer of
+// a FallbackFixer.
+func (hc *HealthChecker) CheckFixes(ctx context.Context, fixes []Fix, settings GuildSettings) []Fix {
+	var res []Fix
+	for _, fix := range fixes {
+		needsCheck := settings.CheckLinks || alwaysChecked(fix.Fixer)
+		if !needsCheck || hc.Healthy(ctx, fix.Fixed) {
+			res = append(res, fix)
+			continue
+		}
+
+		for _, f := range alternatives(fix.Fixer) {
+			fixed := ApplyFixer(f, fix.Original, settings)
+			if fixed != fix.Fixed && fixed != fix.Original && hc.Healthy(ctx, fixed) {
+				fix.Fixed = fixed
+				res = append(res, fix)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// alwaysChecked reports whether the links f fixes are checked even if
+// GuildSettings.CheckLinks is not set.
+func alwaysChecked(f Fixer) bool {
+	switch f := f.(type) {
+	case MirrorFixer:
+		return f.Strategy == MirrorFirstHealthy
+	case FallbackFixer:
+		return len(f.Fixers) > 0 && alwaysChecked(f.Fixers[0])
+	default:
+		return false
+	}
+}
+
+// alternatives returns the fixers that are tried in turn when the link f
+// fixed is down, with those of a FallbackFixer's MirrorFixers in place of
+// the mirrors.
+func alternatives(f Fixer) []Fixer {
+	if mf, ok := f.(MirrorFixer); ok && len(mf.Instances) <= 1 {
+		return []Fixer{f}
+	}
+	af, ok := f.(AlternativesFixer)
+	if !ok {
+		return []Fixer{f}
+	}
+
+	var res []Fixer
+	for _, alternative := range af.Alternatives() {
+		res = append(res, alternatives(alternative)...)
+	}
+	return res
+}
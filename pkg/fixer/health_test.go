@@ -0,0 +1,98 @@
+package fixer_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// newInstance starts a TLS server that responds with status, and returns it
+// with its host.
+func newInstance(t *testing.T, status int) (*httptest.Server, string) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, strings.TrimPrefix(srv.URL, "https://")
+}
+
+// newChecker returns a HealthChecker that trusts srv's certificate, which
+// every httptest TLS server shares.
+func newChecker(srv *httptest.Server) *fixer.HealthChecker {
+	hc := fixer.NewHealthChecker()
+	hc.Client = srv.Client()
+	return hc
+}
+
+func TestCheckFixesFallsBack(t *testing.T) {
+	downSrv, down := newInstance(t, http.StatusBadGateway)
+	_, up := newInstance(t, http.StatusOK)
+	hc := newChecker(downSrv)
+
+	f := fixer.FallbackFixer{Fixers: []fixer.Fixer{
+		fixer.ReplaceFixer{Old: "twitter.com", New: down},
+		fixer.ReplaceFixer{Old: "twitter.com", New: up},
+	}}
+	fixes := []fixer.Fix{{
+		Original: "https://twitter.com/a/status/1",
+		Fixed:    "https://" + down + "/a/status/1",
+		Domain:   "twitter.com",
+		Fixer:    f,
+	}}
+
+	// Links are not checked unless the guild asks for it.
+	got := hc.CheckFixes(context.Background(), fixes, fixer.GuildSettings{})
+	if len(got) != 1 || got[0].Fixed != fixes[0].Fixed {
+		t.Errorf("CheckFixes without CheckLinks = %v, want %v", got, fixes)
+	}
+
+	got = hc.CheckFixes(context.Background(), fixes, fixer.GuildSettings{CheckLinks: true})
+	if want := "https://" + up + "/a/status/1"; len(got) != 1 || got[0].Fixed != want {
+		t.Errorf("CheckFixes = %v, want a fix to %v", got, want)
+	}
+
+	// Fixes are dropped when every alternative is down.
+	f.Fixers = f.Fixers[:1]
+	fixes[0].Fixer = f
+	got = hc.CheckFixes(context.Background(), fixes, fixer.GuildSettings{CheckLinks: true})
+	if len(got) != 0 {
+		t.Errorf("CheckFixes with every alternative down = %v, want none", got)
+	}
+}
+
+func TestCheckFixesFirstHealthyMirror(t *testing.T) {
+	downSrv, down := newInstance(t, http.StatusServiceUnavailable)
+	_, up := newInstance(t, http.StatusOK)
+	mirror, err := fixer.NewMirrorFixer(fixer.MirrorFirstHealthy, []string{down, up})
+	if err != nil {
+		t.Fatalf("NewMirrorFixer failed: %v", err)
+	}
+
+	for name, f := range map[string]fixer.Fixer{
+		"Mirror": mirror,
+		// First-healthy mirrors are checked even inside a fallback, and
+		// their instances are tried before the fallback.
+		"InFallback": fixer.WithFallback(mirror, fixer.ReplaceFixer{Old: "youtube.com", New: "fallback.example"}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := fixer.NewMemoryStore()
+			_, err := s.Put(guildID, "youtube.com", f, actorID)
+			if err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+
+			p := fixer.Pipeline{Store: s, Checker: newChecker(downSrv)}
+			fixes, err := p.FixLinks(context.Background(), guildID, "https://youtube.com/watch?v=1", fixer.GuildSettings{})
+			if err != nil {
+				t.Fatalf("FixLinks failed: %v", err)
+			}
+			if want := "https://" + up + "/watch"; len(fixes) != 1 || fixes[0].Fixed != want {
+				t.Errorf("FixLinks = %v, want a fix to %v", fixes, want)
+			}
+		})
+	}
+}
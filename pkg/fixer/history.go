@@ -0,0 +1,73 @@
+package fixer
+
+import (
+	"fmt"
+	"time"
+)
+
+// A Change records a single modification of a guild's fixer for a domain.
+type Change struct {
+	GuildID string
+	Domain  string
+	ActorID string
+	Time    time.Time
+
+	// Old is the fixer before the change, or nil if the fixer was created.
+	Old Fixer
+	// New is the fixer after the change, or nil if the fixer was deleted.
+	New Fixer
+
+	// Undo reports whether the change was made by Store.Undo, reverting the
+	// most recent change to the domain that had not been undone.
+	Undo bool
+}
+
+func (c Change) String() string {
+	var res string
+	switch {
+	case c.Old == nil:
+		res = fmt.Sprintf("created `%v` → `%v`", c.Domain, c.New)
+	case c.New == nil:
+		res = fmt.Sprintf("deleted `%v` → `%v`", c.Domain, c.Old)
+	default:
+		res = fmt.Sprintf("changed `%v` from `%v` to `%v`", c.Domain, c.Old, c.New)
+	}
+	if c.Undo {
+		res += " (undo)"
+	}
+	return res
+}
+
+// LastUndoable returns the most recent change in history, which is newest
+// first as returned by Store.History, that has not been undone, so that
+// undoing repeatedly steps further back rather than flipping between two
+// fixers. It returns false if every change has been undone.
+func LastUndoable(history []Change) (Change, bool) {
+	// Replay the history oldest first, keeping the changes to each domain
+	// that have not been undone, with the index of each in history. Each
+	// undo reverts the newest of these for its domain.
+	stacks := map[string][]int{}
+	for n := len(history) - 1; n >= 0; n-- {
+		c := history[n]
+		stack := stacks[c.Domain]
+		if c.Undo {
+			if len(stack) > 0 {
+				stacks[c.Domain] = stack[:len(stack)-1]
+			}
+			continue
+		}
+		stacks[c.Domain] = append(stack, n)
+	}
+
+	// Lower indexes are newer.
+	last := -1
+	for _, stack := range stacks {
+		if len(stack) > 0 && (last < 0 || stack[len(stack)-1] < last) {
+			last = stack[len(stack)-1]
+		}
+	}
+	if last < 0 {
+		return Change{}, false
+	}
+	return history[last], true
+}
@@ -0,0 +1,102 @@
+package fixer_test
+
+import (
+	"testing"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+func TestLastUndoable(t *testing.T) {
+	a := fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"}
+	b := fixer.ReplaceFixer{Old: "twitter.com", New: "fxtwitter.com"}
+	c := fixer.ReplaceFixer{Old: "twitter.com", New: "fixupx.com"}
+	r := fixer.ReplaceFixer{Old: "reddit.com", New: "old.reddit.com"}
+
+	change := func(domain string, old fixer.Fixer, new fixer.Fixer) fixer.Change {
+		return fixer.Change{GuildID: guildID, Domain: domain, ActorID: actorID, Old: old, New: new}
+	}
+	undo := func(domain string, old fixer.Fixer, new fixer.Fixer) fixer.Change {
+		c := change(domain, old, new)
+		c.Undo = true
+		return c
+	}
+
+	// Histories are oldest first here, and reversed to match Store.History.
+	tests := []struct {
+		name    string
+		history []fixer.Change
+		want    int // index of the undoable change, or -1 for none
+	}{
+		{"Empty", nil, -1},
+		{"Single", []fixer.Change{change("twitter.com", nil, a)}, 0},
+		{"Newest", []fixer.Change{
+			change("twitter.com", nil, a),
+			change("twitter.com", a, b),
+		}, 1},
+		// Undoing the second change sets the fixer back to a, so the next
+		// undo removes it rather than setting it back to b.
+		{"UndoneOnce", []fixer.Change{
+			change("twitter.com", nil, a),
+			change("twitter.com", a, b),
+			undo("twitter.com", b, a),
+		}, 0},
+		{"UndoneTwice", []fixer.Change{
+			change("twitter.com", nil, a),
+			change("twitter.com", a, b),
+			undo("twitter.com", b, a),
+			undo("twitter.com", a, nil),
+		}, -1},
+		{"ChangedAfterUndo", []fixer.Change{
+			change("twitter.com", nil, a),
+			change("twitter.com", a, b),
+			undo("twitter.com", b, a),
+			change("twitter.com", a, c),
+		}, 3},
+		// Setting a fixer back by hand is not an undo, so it can itself be
+		// undone.
+		{"RevertedByHand", []fixer.Change{
+			change("twitter.com", nil, a),
+			change("twitter.com", a, b),
+			change("twitter.com", b, a),
+		}, 2},
+		// Undoing the newest change on the server skips to the newest
+		// change to another domain that is still in effect.
+		{"OtherDomain", []fixer.Change{
+			change("twitter.com", nil, a),
+			change("reddit.com", nil, r),
+			change("twitter.com", a, b),
+			undo("twitter.com", b, a),
+		}, 1},
+		// Deleting a fixer is not an undo of creating it.
+		{"Deleted", []fixer.Change{
+			change("twitter.com", nil, a),
+			change("twitter.com", a, nil),
+		}, 1},
+		{"DeletedUndone", []fixer.Change{
+			change("twitter.com", nil, a),
+			change("twitter.com", a, nil),
+			undo("twitter.com", nil, a),
+		}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := make([]fixer.Change, len(tt.history))
+			for n, c := range tt.history {
+				history[len(history)-1-n] = c
+			}
+
+			got, ok := fixer.LastUndoable(history)
+			if tt.want < 0 {
+				if ok {
+					t.Errorf("LastUndoable = %+v, want none", got)
+				}
+				return
+			}
+			want := tt.history[tt.want]
+			if !ok || got.Domain != want.Domain || !fixer.EqualFixers(got.Old, want.Old) || !fixer.EqualFixers(got.New, want.New) || got.Undo != want.Undo {
+				t.Errorf("LastUndoable = %+v, %v, want %+v", got, ok, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package fixer
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// A MemoryStore is a Store that keeps everything in memory. Its contents are
+// lost when the process exits, so it is mostly useful for tests and
+// ephemeral deployments.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	fixers   map[string]map[string]Fixer
+	history  map[string][]Change
+	settings map[string]GuildSettings
+	departed map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		fixers:   map[string]map[string]Fixer{},
+		history:  map[string][]Change{},
+		settings: map[string]GuildSettings{},
+		departed: map[string]time.Time{},
+	}
+}
+
+func (ms *MemoryStore) Put(guildID string, domain string, f Fixer, actorID string) (Change, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.put(guildID, domain, f, actorID, false), nil
+}
+
+func (ms *MemoryStore) Undo(c Change, actorID string) (Change, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if c.Old == nil {
+		change, deleted := ms.delete(c.GuildID, c.Domain, actorID, true)
+		return change, deleted, nil
+	}
+	return ms.put(c.GuildID, c.Domain, c.Old, actorID, true), true, nil
+}
+
+// put sets the guild's fixer for domain, and records and returns the change.
+// ms.mu must be held.
+func (ms *MemoryStore) put(guildID string, domain string, f Fixer, actorID string, undo bool) Change {
+	guildFixers, ok := ms.fixers[guildID]
+	if !ok {
+		guildFixers = map[string]Fixer{}
+		ms.fixers[guildID] = guildFixers
+	}
+
+	old := guildFixers[domain]
+	guildFixers[domain] = f
+
+	log.Info("created fixer", "guildID", guildID, "domain", domain, "fixer", f, "actorID", actorID)
+	c := Change{
+		GuildID: guildID,
+		Domain:  domain,
+		ActorID: actorID,
+		Time:    time.Now(),
+		Old:     old,
+		New:     f,
+		Undo:    undo,
+	}
+	ms.history[guildID] = append(ms.history[guildID], c)
+	return c
+}
+
+func (ms *MemoryStore) Get(guildID string, domain string) (Fixer, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	guildFixers, ok := ms.fixers[guildID]
+	if !ok {
+		return nil, fmt.Errorf("could not find guild %v: %w", guildID, ErrGuildNotFound)
+	}
+
+	f, ok := guildFixers[domain]
+	if !ok {
+		return nil, fmt.Errorf("could not find fixer for %v: %w", domain, ErrNotFound)
+	}
+	return f, nil
+}
+
+func (ms *MemoryStore) Delete(guildID string, domain string, actorID string) (Change, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	c, deleted := ms.delete(guildID, domain, actorID, false)
+	return c, deleted, nil
+}
+
+// delete deletes the guild's fixer for domain, and records and returns the
+// change, reporting whether there was one to delete. ms.mu must be held.
+func (ms *MemoryStore) delete(guildID string, domain string, actorID string, undo bool) (Change, bool) {
+	old, ok := ms.fixers[guildID][domain]
+	if !ok {
+		return Change{}, false
+	}
+	delete(ms.fixers[guildID], domain)
+
+	log.Info("deleted fixer", "guildID", guildID, "domain", domain, "actorID", actorID)
+	c := Change{
+		GuildID: guildID,
+		Domain:  domain,
+		ActorID: actorID,
+		Time:    time.Now(),
+		Old:     old,
+		Undo:    undo,
+	}
+	ms.history[guildID] = append(ms.history[guildID], c)
+	return c, true
+}
+
+func (ms *MemoryStore) List(guildID string) (map[string]Fixer, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	guildFixers, ok := ms.fixers[guildID]
+	if !ok {
+		return nil, fmt.Errorf("could not find guild %v: %w", guildID, ErrGuildNotFound)
+	}
+
+	res := make(map[string]Fixer, len(guildFixers))
+	for domain, f := range guildFixers {
+		res[domain] = f
+	}
+	return res, nil
+}
+
+func (ms *MemoryStore) History(guildID string, domain string) ([]Change, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var res []Change
+	changes := ms.history[guildID]
+	for n := len(changes) - 1; n >= 0; n-- {
+		if domain != "" && changes[n].Domain != domain {
+			continue
+		}
+		res = append(res, changes[n])
+	}
+	return res, nil
+}
+
+func (ms *MemoryStore) GetSettings(guildID string) (GuildSettings, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.settings[guildID], nil
+}
+
+func (ms *MemoryStore) PutSettings(guildID string, settings GuildSettings) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.settings[guildID] = settings
+	log.Info("updated settings", "guildID", guildID, "settings", settings)
+	return nil
+}
+
+func (ms *MemoryStore) MarkDeparted(guildID string, at time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if at.IsZero() {
+		delete(ms.departed, guildID)
+	} else {
+		ms.departed[guildID] = at
+	}
+	return nil
+}
+
+func (ms *MemoryStore) Departed() (map[string]time.Time, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	res := make(map[string]time.Time, len(ms.departed))
+	for guildID, at := range ms.departed {
+		res[guildID] = at
+	}
+	return res, nil
+}
+
+func (ms *MemoryStore) Purge(guildID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.fixers, guildID)
+	delete(ms.history, guildID)
+	delete(ms.settings, guildID)
+	delete(ms.departed, guildID)
+	log.Info("purged guild", "guildID", guildID)
+	return nil
+}
+
+func (ms *MemoryStore) Guilds() ([]string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	guilds := map[string]bool{}
+	for guildID := range ms.fixers {
+		guilds[guildID] = true
+	}
+	for guildID := range ms.history {
+		guilds[guildID] = true
+	}
+	for guildID := range ms.settings {
+		guilds[guildID] = true
+	}
+	for guildID := range ms.departed {
+		guilds[guildID] = true
+	}
+	return slices.Sorted(maps.Keys(guilds)), nil
+}
+
+func (ms *MemoryStore) Sizes() (map[string]int, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	res := make(map[string]int, len(ms.fixers))
+	for guildID, guildFixers := range ms.fixers {
+		res[guildID] = len(guildFixers)
+	}
+	return res, nil
+}
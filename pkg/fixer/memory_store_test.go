@@ -0,0 +1,14 @@
+package fixer_test
+
+import (
+	"testing"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer/storetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) fixer.Store {
+		return fixer.NewMemoryStore()
+	})
+}
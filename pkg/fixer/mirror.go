@@ -0,0 +1,173 @@
+package fixer
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A MirrorStrategy controls which instance a MirrorFixer points links at.
+type MirrorStrategy string
+
+const (
+	// MirrorFirstHealthy uses the first instance that is up. Instances are
+	// always checked to be up, whatever GuildSettings.CheckLinks is.
+	MirrorFirstHealthy MirrorStrategy = "first-healthy"
+	// MirrorRoundRobin takes turns between the instances.
+	MirrorRoundRobin MirrorStrategy = "round-robin"
+	// MirrorRandom uses a random instance.
+	MirrorRandom MirrorStrategy = "random"
+)
+
+// MirrorStrategies lists every MirrorStrategy.
+var MirrorStrategies = []MirrorStrategy{MirrorFirstHealthy, MirrorRoundRobin, MirrorRandom}
+
+// mirrorTurns holds the turn of each round-robin MirrorFixer, keyed by the
+// scope and domain it is stored under. Turns are kept here rather than in
+// stored fixers, as most stores decode a new copy of a fixer on each Get.
+var mirrorTurns sync.Map
+
+// A MirrorFixer points links at one of several instances of a frontend, such
+// as Invidious or Nitter, by replacing the link's host with the instance's.
+type MirrorFixer struct {
+	// Instances are the hosts of the instances, e.g. "yewtu.be".
+	Instances []string
+	Strategy  MirrorStrategy
+
+	// turn is the index of the next instance a round-robin MirrorFixer
+	// points links at, shared by every copy of the fixer returned by Lookup.
+	// Without one, the first instance is always used.
+	turn *atomic.Uint64
+}
+
+// withMirrorTurns returns f with the turns of the round-robin MirrorFixers in
+// it, which are found in key and below.
+func withMirrorTurns(f Fixer, key string) Fixer {
+	switch f := f.(type) {
+	case MirrorFixer:
+		if f.Strategy == MirrorRoundRobin {
+			turn, _ := mirrorTurns.LoadOrStore(key, &atomic.Uint64{})
+			f.turn = turn.(*atomic.Uint64)
+		}
+		return f
+	case FallbackFixer:
+		fixers := make([]Fixer, len(f.Fixers))
+		for n, ff := range f.Fixers {
+			fixers[n] = withMirrorTurns(ff, fmt.Sprintf("%v/%v", key, n))
+		}
+		return FallbackFixer{Fixers: fixers}
+	default:
+		return f
+	}
+}
+
+// NewMirrorFixer returns a MirrorFixer for instances, which may be given as
+// URLs, checking that they and strategy are valid.
+func NewMirrorFixer(strategy MirrorStrategy, instances []string) (MirrorFixer, error) {
+	if !slices.Contains(MirrorStrategies, strategy) {
+		return MirrorFixer{}, fmt.Errorf("unknown mirror strategy %q (should be one of %v)", strategy, MirrorStrategies)
+	}
+	if len(instances) == 0 {
+		return MirrorFixer{}, fmt.Errorf("mirror fixers need at least one instance")
+	}
+
+	f := MirrorFixer{Strategy: strategy}
+	for _, instance := range instances {
+		host, err := MirrorInstanceHost(instance)
+		if err != nil {
+			return MirrorFixer{}, err
+		}
+		f.Instances = append(f.Instances, host)
+	}
+	return f, nil
+}
+
+// MirrorInstanceHost returns the host of an instance given as a host or URL.
+func MirrorInstanceHost(instance string) (string, error) {
+	instance = strings.TrimSpace(instance)
+	if !strings.Contains(instance, "://") {
+		instance = "https://" + instance
+	}
+
+	u, err := url.Parse(instance)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid instance %q", instance)
+	}
+	return u.Host, nil
+}
+
+// Alternatives returns a single-instance MirrorFixer per instance, in the
+// order the strategy tries them. Round-robin fixers start at their next
+// turn, without taking it.
+func (f MirrorFixer) Alternatives() []Fixer {
+	instances := slices.Clone(f.Instances)
+	if len(instances) > 1 {
+		switch f.Strategy {
+		case MirrorRoundRobin:
+			if f.turn != nil {
+				turn := int(f.turn.Load() % uint64(len(instances)))
+				instances = append(instances[turn:], instances[:turn]...)
+			}
+		case MirrorRandom:
+			rand.Shuffle(len(instances), func(i, j int) {
+				instances[i], instances[j] = instances[j], instances[i]
+			})
+		}
+	}
+
+	var res []Fixer
+	for _, instance := range instances {
+		res = append(res, MirrorFixer{Instances: []string{instance}, Strategy: f.Strategy})
+	}
+	return res
+}
+
+// Fix replaces link's host with that of the instance chosen by f.Strategy,
+// taking a turn if it is MirrorRoundRobin. Without health checks,
+// MirrorFirstHealthy uses the first instance.
+func (f MirrorFixer) Fix(link string) string {
+	if len(f.Instances) == 0 {
+		return link
+	}
+
+	instance := f.Instances[0]
+	switch f.Strategy {
+	case MirrorRoundRobin:
+		if f.turn != nil {
+			instance = f.Instances[(f.turn.Add(1)-1)%uint64(len(f.Instances))]
+		}
+	case MirrorRandom:
+		instance = f.Instances[rand.IntN(len(f.Instances))]
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	u.Scheme = "https"
+	u.Host = instance
+	return u.String()
+}
+
+// IsFixed reports whether link already points at one of f's instances.
+func (f MirrorFixer) IsFixed(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && slices.Contains(f.Instances, u.Host)
+}
+
+// OutputDomains returns the domains of all of f's instances.
+func (f MirrorFixer) OutputDomains(domain string) []string {
+	var res []string
+	for _, instance := range f.Instances {
+		res = append(res, ExtractDomain(instance))
+	}
+	return res
+}
+
+func (f MirrorFixer) String() string {
+	return fmt.Sprintf("mirror to %v (%v)", strings.Join(f.Instances, ", "), f.Strategy)
+}
@@ -0,0 +1,102 @@
+package fixer_test
+
+import (
+	"testing"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+func TestMirrorFixerRoundRobinAlternates(t *testing.T) {
+	for name, newStore := range map[string]func(t *testing.T) fixer.Store{
+		"Memory": func(t *testing.T) fixer.Store { return fixer.NewMemoryStore() },
+		"Bolt":   newBoltStore,
+		"Cached": func(t *testing.T) fixer.Store { return fixer.NewCachingStore(newBoltStore(t)) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Turns are kept per scope, so use one no other test uses.
+			scope := t.Name()
+			s := newStore(t)
+			f, err := fixer.NewMirrorFixer(fixer.MirrorRoundRobin, []string{"a.example", "b.example"})
+			if err != nil {
+				t.Fatalf("NewMirrorFixer failed: %v", err)
+			}
+			_, err = s.Put(scope, "youtube.com", f, actorID)
+			if err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			_, err = s.Put(scope, "twitter.com", f, actorID)
+			if err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+
+			// Each fixer takes its own turns, so fixing twitter.com links
+			// in between does not change which instance youtube.com links
+			// get.
+			var previous string
+			for n := range 6 {
+				fixes, err := fixer.FixLinks(s, scope, "https://youtube.com/watch?v=1 https://twitter.com/a", fixer.GuildSettings{})
+				if err != nil {
+					t.Fatalf("FixLinks failed: %v", err)
+				}
+				if len(fixes) != 2 {
+					t.Fatalf("message %v: got %v fixes, want 2", n, len(fixes))
+				}
+
+				instance := fixer.ExtractDomain(fixes[0].Fixed)
+				if got := fixer.ExtractDomain(fixes[1].Fixed); got != instance {
+					t.Errorf("message %v: %v fixed to %v, but %v fixed to %v", n, fixes[0].Original, instance, fixes[1].Original, got)
+				}
+				if instance == previous {
+					t.Errorf("message %v: fixed to %v again", n, instance)
+				}
+				previous = instance
+			}
+		})
+	}
+}
+
+func TestMirrorFixerAlternativesDoNotTakeTurn(t *testing.T) {
+	scope := t.Name()
+	s := fixer.NewMemoryStore()
+	f, err := fixer.NewMirrorFixer(fixer.MirrorRoundRobin, []string{"a.example", "b.example", "c.example"})
+	if err != nil {
+		t.Fatalf("NewMirrorFixer failed: %v", err)
+	}
+	_, err = s.Put(scope, "youtube.com", f, actorID)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	looked, err := fixer.Lookup(s, scope, "youtube.com")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	mf := looked.(fixer.MirrorFixer)
+
+	for range 3 {
+		mf.Alternatives()
+	}
+	first := mf.Fix("https://youtube.com/watch")
+	second := mf.Fix("https://youtube.com/watch")
+	if first == second {
+		t.Errorf("consecutive fixes both used %v", first)
+	}
+
+	// Alternatives start from the instance the next Fix uses.
+	alternative := mf.Alternatives()[0].Fix("https://youtube.com/watch")
+	if next := mf.Fix("https://youtube.com/watch"); alternative != next {
+		t.Errorf("first alternative = %v, want the next instance %v", alternative, next)
+	}
+}
+
+func TestMirrorFixerFirstHealthyWithoutChecks(t *testing.T) {
+	f, err := fixer.NewMirrorFixer(fixer.MirrorFirstHealthy, []string{"https://a.example/", "b.example"})
+	if err != nil {
+		t.Fatalf("NewMirrorFixer failed: %v", err)
+	}
+	for range 3 {
+		if got := f.Fix("http://youtube.com/watch?v=1"); got != "https://a.example/watch?v=1" {
+			t.Errorf("Fix = %v, want https://a.example/watch?v=1", got)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package fixer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// A Fix is a link found in a message along with its fixed version.
+type Fix struct {
+	Original string
+	Fixed    string
+	Domain   string
+	Fixer    Fixer
+}
+
+// A Pipeline fixes the links in messages the same way wherever they come
+// from: it expands shortened links, fixes them with FixLinks and checks that
+// the fixed links are up.
+type Pipeline struct {
+	Store Store
+	// Expander expands shortened links. Links are not expanded if it is nil.
+	Expander *Expander
+	// Checker checks that fixed links are up. They are not checked if it is
+	// nil.
+	Checker *HealthChecker
+}
+
+// FixLinks fixes the links in text in the guild. Shortened links are only
+// expanded in guilds that have fixers, so that messages elsewhere never
+// cause requests.
+func (p Pipeline) FixLinks(ctx context.Context, guildID string, text string, settings GuildSettings) ([]Fix, error) {
+	if len(ExtractURLs(text)) == 0 {
+		return nil, nil
+	}
+
+	ok, err := HasFixers(p.Store, guildID, settings)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	text = p.Expander.ExpandLinks(ctx, text)
+
+	fixes, err := FixLinks(p.Store, guildID, text, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Checker != nil {
+		fixes = p.Checker.CheckFixes(ctx, fixes, settings)
+	}
+	return fixes, nil
+}
+
+// HasFixers reports whether any fixers apply in the guild.
+func HasFixers(s Store, guildID string, settings GuildSettings) (bool, error) {
+	scopes := []string{guildID}
+	if !settings.IgnoreGlobalFixers {
+		scopes = append(scopes, GlobalScope)
+	}
+
+	for _, scope := range scopes {
+		domains, err := scopeOutputDomains(s, scope)
+		if errors.Is(err, ErrGuildNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("could not list fixers: %w", err)
+		}
+		if len(domains) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FixLinks finds the links in text and fixes those that have a fixer in the
+// guild, following the guild's settings.
+//
+// Links on a domain that any of the guild's fixers produce links on are
+// never fixed, so that the bot cannot end up fixing its own output, or that
+// of other bots using the same fixers. Neither are links that are already in
+// the form their fixer produces, or that their fixer leaves unchanged.
+func FixLinks(s Store, guildID string, text string, settings GuildSettings) ([]Fix, error) {
+	links := ExtractURLs(text)
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	outputs, err := OutputDomains(s, guildID, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixes []Fix
+	for _, link := range links {
+		domain := ExtractDomain(link)
+		if outputs[domain] {
+			continue
+		}
+
+		f, err := Lookup(s, guildID, domain)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not look up fixer for %v: %w", domain, err)
+		}
+
+		if fc, ok := f.(FixedChecker); ok && fc.IsFixed(link) {
+			continue
+		}
+
+		fixed := ApplyFixer(f, link, settings)
+		if fixed == link {
+			// The fixer had nothing to fix.
+			continue
+		}
+
+		fixes = append(fixes, Fix{
+			Original: link,
+			Fixed:    fixed,
+			Domain:   domain,
+			Fixer:    f,
+		})
+	}
+
+	return fixes, nil
+}
+
+// ApplyFixer fixes link with f, removing its query first unless settings
+// keep query parameters or f is a QueryFixer that reads it.
+func ApplyFixer(f Fixer, link string, settings GuildSettings) string {
+	if !settings.KeepQueryParams && !usesQuery(f) {
+		link = RemoveQueryParams(link)
+	}
+	return f.Fix(link)
+}
+
+// usesQuery reports whether f, or the fixer a FallbackFixer uses first,
+// reads the query of links.
+func usesQuery(f Fixer) bool {
+	switch f := f.(type) {
+	case QueryFixer:
+		return f.UsesQuery()
+	case FallbackFixer:
+		return len(f.Fixers) > 0 && usesQuery(f.Fixers[0])
+	default:
+		return false
+	}
+}
+
+// OutputDomains returns the domains that the fixers applying in the guild
+// turn links into. Domains the guild has fixers for are left out, as fixing
+// them was asked for explicitly.
+func OutputDomains(s Store, guildID string, settings GuildSettings) (map[string]bool, error) {
+	scopes := []string{guildID}
+	if !settings.IgnoreGlobalFixers {
+		scopes = append(scopes, GlobalScope)
+	}
+
+	outputs := map[string]bool{}
+	inputs := map[string]bool{}
+	for _, scope := range scopes {
+		domains, err := scopeOutputDomains(s, scope)
+		if errors.Is(err, ErrGuildNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not list fixers: %w", err)
+		}
+
+		for domain, fixerOutputs := range domains {
+			inputs[domain] = true
+			for _, output := range fixerOutputs {
+				outputs[output] = true
+			}
+		}
+	}
+
+	for domain := range inputs {
+		delete(outputs, domain)
+	}
+	return outputs, nil
+}
+
+// scopeOutputDomains returns the output domains of the fixer for each domain
+// in the scope. A CachingStore keeps them with its cached fixers, so they are
+// only found again after the scope's fixers change.
+func scopeOutputDomains(s Store, scope string) (map[string][]string, error) {
+	if cs, ok := s.(*CachingStore); ok {
+		return cs.outputDomains(scope)
+	}
+
+	fixers, err := s.List(scope)
+	if err != nil {
+		return nil, err
+	}
+	return outputDomainsOf(fixers), nil
+}
+
+// outputDomainsOf returns the output domains of the fixer for each domain in
+// fixers.
+func outputDomainsOf(fixers map[string]Fixer) map[string][]string {
+	res := make(map[string][]string, len(fixers))
+	for domain, f := range fixers {
+		res[domain] = FixerOutputDomains(domain, f)
+	}
+	return res
+}
+
+// FixerOutputDomains returns the domains f turns links on domain into, or
+// none if f is not an OutputDomainer.
+func FixerOutputDomains(domain string, f Fixer) []string {
+	od, ok := f.(OutputDomainer)
+	if !ok {
+		return nil
+	}
+
+	var res []string
+	for _, output := range od.OutputDomains(domain) {
+		if output != "" {
+			res = append(res, output)
+		}
+	}
+	return res
+}
+
+// rootOutputDomains returns the domain of the link fix turns domain's root
+// link into, for fixers whose output domain depends on the link.
+func rootOutputDomains(domain string, fix func(string) string) []string {
+	output := ExtractDomain(fix("https://" + domain + "/"))
+	if output == "" {
+		return nil
+	}
+	return []string{output}
+}
@@ -0,0 +1,133 @@
+package fixer_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+func TestOutputDomains(t *testing.T) {
+	fixers := map[string]fixer.Fixer{
+		"twitter.com":   fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"},
+		"m.twitter.com": fixer.ReplaceFixer{Old: "m.twitter.com", New: "twitter.com"},
+		"reddit.com":    fixer.RegexpReplaceFixer{Pattern: `(www\.)?reddit\.com`, Replacement: "old.reddit.com"},
+		"tiktok.com":    fixer.PrependFixer{Prefix: "https://proxy.example/"},
+		"youtube.com":   fixer.MirrorFixer{Instances: []string{"a.example", "b.example"}, Strategy: fixer.MirrorRoundRobin},
+		"x.com": fixer.FallbackFixer{Fixers: []fixer.Fixer{
+			fixer.TemplateFixer{Template: "https://fixupx.com{{.Path}}"},
+			fixer.ReplaceFixer{Old: "x.com", New: "fxtwitter.com"},
+		}},
+	}
+
+	// twitter.com is left out, as it has a fixer of its own.
+	want := map[string]bool{
+		"vxtwitter.com":  true,
+		"old.reddit.com": true,
+		"proxy.example":  true,
+		"a.example":      true,
+		"b.example":      true,
+		"fixupx.com":     true,
+		"fxtwitter.com":  true,
+	}
+
+	for name, s := range map[string]fixer.Store{
+		"Uncached": fixer.NewMemoryStore(),
+		"Cached":   fixer.NewCachingStore(fixer.NewMemoryStore()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for domain, f := range fixers {
+				_, err := s.Put(guildID, domain, f, actorID)
+				if err != nil {
+					t.Fatalf("Put failed: %v", err)
+				}
+			}
+
+			got, err := fixer.OutputDomains(s, guildID, fixer.GuildSettings{})
+			if err != nil {
+				t.Fatalf("OutputDomains failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("OutputDomains = %v, want %v", got, want)
+			}
+
+			// Output domains are updated when fixers change.
+			_, err = s.Put(guildID, "tiktok.com", fixer.PrependFixer{Prefix: "https://other.example/"}, actorID)
+			if err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			got, err = fixer.OutputDomains(s, guildID, fixer.GuildSettings{})
+			if err != nil {
+				t.Fatalf("OutputDomains failed: %v", err)
+			}
+			if got["proxy.example"] || !got["other.example"] {
+				t.Errorf("OutputDomains after Put = %v, want other.example instead of proxy.example", got)
+			}
+		})
+	}
+}
+
+func TestHasFixers(t *testing.T) {
+	s := fixer.NewMemoryStore()
+	scope := t.Name()
+
+	ok, err := fixer.HasFixers(s, scope, fixer.GuildSettings{})
+	if err != nil {
+		t.Fatalf("HasFixers failed: %v", err)
+	}
+	if ok {
+		t.Errorf("HasFixers with no fixers = true")
+	}
+
+	_, err = s.Put(fixer.GlobalScope, "twitter.com", fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"}, actorID)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	ok, err = fixer.HasFixers(s, scope, fixer.GuildSettings{})
+	if err != nil {
+		t.Fatalf("HasFixers failed: %v", err)
+	}
+	if !ok {
+		t.Errorf("HasFixers with a global fixer = false")
+	}
+
+	ok, err = fixer.HasFixers(s, scope, fixer.GuildSettings{IgnoreGlobalFixers: true})
+	if err != nil {
+		t.Fatalf("HasFixers failed: %v", err)
+	}
+	if ok {
+		t.Errorf("HasFixers ignoring global fixers = true")
+	}
+}
+
+func TestPipelineExpandsOnlyWithFixers(t *testing.T) {
+	srv, requests := newShortener(t, map[string]string{"/a": "https://twitter.com/a/status/1"})
+	s := fixer.NewMemoryStore()
+	scope := t.Name()
+	p := fixer.Pipeline{Store: s, Expander: fixer.NewExpander([]string{"127.0.0.1"})}
+
+	// Messages in guilds without fixers never cause requests.
+	fixes, err := p.FixLinks(context.Background(), scope, srv.URL+"/a", fixer.GuildSettings{})
+	if err != nil {
+		t.Fatalf("FixLinks failed: %v", err)
+	}
+	if len(fixes) != 0 {
+		t.Errorf("FixLinks without fixers = %v, want none", fixes)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("shortener got %v requests without fixers, want 0", n)
+	}
+
+	_, err = s.Put(scope, "twitter.com", fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"}, actorID)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	fixes, err = p.FixLinks(context.Background(), scope, srv.URL+"/a", fixer.GuildSettings{})
+	if err != nil {
+		t.Fatalf("FixLinks failed: %v", err)
+	}
+	if want := "https://vxtwitter.com/a/status/1"; len(fixes) != 1 || fixes[0].Fixed != want {
+		t.Errorf("FixLinks = %v, want a fix to %v", fixes, want)
+	}
+}
@@ -0,0 +1,95 @@
+package fixer
+
+import (
+	"errors"
+	"strings"
+)
+
+// GlobalScope is the reserved guild ID under which bot-wide default fixers
+// are stored. They apply in every guild that has no fixer of its own for a
+// domain, unless the guild has set GuildSettings.IgnoreGlobalFixers.
+//
+// Discord IDs are numeric, so GlobalScope cannot collide with a real guild.
+const GlobalScope = "_global"
+
+// userScopePrefix starts the scopes of users' personal fixers. It is not
+// numeric, so user scopes cannot collide with real guilds either.
+const userScopePrefix = "user:"
+
+// UserScope returns the guild ID under which a user's personal fixers and
+// settings are stored. They apply to links the user posts in DMs with the
+// bot, where there is no guild.
+func UserScope(userID string) string {
+	return userScopePrefix + userID
+}
+
+// IsUserScope reports whether guildID is a user scope created by UserScope.
+func IsUserScope(guildID string) bool {
+	return strings.HasPrefix(guildID, userScopePrefix)
+}
+
+// Lookup returns the fixer that applies to domain in the guild: the guild's
+// own fixer if it has one, otherwise the global fixer. It returns
+// ErrNotFound if neither exists.
+//
+// Round-robin MirrorFixers returned by Lookup take turns between their
+// instances, separately for each fixer.
+func Lookup(s Store, guildID string, domain string) (Fixer, error) {
+	f, err := s.Get(guildID, domain)
+	if err == nil {
+		return withMirrorTurns(f, guildID+"/"+domain), nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	settings, err := s.GetSettings(guildID)
+	if err != nil {
+		return nil, err
+	}
+	if settings.IgnoreGlobalFixers {
+		return nil, ErrNotFound
+	}
+
+	f, err = s.Get(GlobalScope, domain)
+	if err != nil {
+		return nil, err
+	}
+	return withMirrorTurns(f, GlobalScope+"/"+domain), nil
+}
+
+// OperatorActorID is the actor ID recorded for changes made by the bot's
+// operator rather than by a Discord user.
+const OperatorActorID = "operator"
+
+// SyncGlobalFixers replaces the global fixers with fixers.
+func SyncGlobalFixers(s Store, fixers map[string]Fixer) error {
+	current, err := s.List(GlobalScope)
+	if err != nil && !errors.Is(err, ErrGuildNotFound) {
+		return err
+	}
+
+	for domain := range current {
+		if _, ok := fixers[domain]; ok {
+			continue
+		}
+
+		_, _, err = s.Delete(GlobalScope, domain, OperatorActorID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for domain, f := range fixers {
+		if EqualFixers(current[domain], f) {
+			continue
+		}
+
+		_, err = s.Put(GlobalScope, domain, f, OperatorActorID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,438 @@
+package fixer
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A ReplyMode controls how fixed links are posted.
+type ReplyMode string
+
+const (
+	// ReplyModeReply posts fixed links as a reply to the original message.
+	ReplyModeReply ReplyMode = "reply"
+	// ReplyModeChannel posts fixed links as a plain message in the channel.
+	ReplyModeChannel ReplyMode = "channel"
+)
+
+// GuildSettings holds a guild's configuration other than its fixers.
+//
+// The zero value of every field is its default, so that settings stored
+// before a field was added keep their default behavior.
+type GuildSettings struct {
+	// LogChannelID is the channel configuration changes are announced in.
+	// Changes are not announced if it is empty.
+	LogChannelID string
+
+	// IgnoreGlobalFixers disables the bot-wide default fixers in the guild.
+	IgnoreGlobalFixers bool
+
+	// ReplyMode controls how fixed links are posted. Empty means
+	// ReplyModeReply.
+	ReplyMode ReplyMode
+
+	// KeepQueryParams keeps query parameters on links instead of stripping
+	// them before fixing.
+	KeepQueryParams bool
+
+	// SuppressMentions stops replies from pinging the original author.
+	SuppressMentions bool
+
+	// PrivateManualFixes only shows links fixed with the "Fix links" message
+	// command to the user who ran it.
+	PrivateManualFixes bool
+
+	// UserFixesPerMinute, ChannelFixesPerMinute and GuildFixesPerMinute limit
+	// how many fixed link messages are posted for each user, in each channel
+	// and in the whole guild. Zero means the default limit, and a negative
+	// value means no limit.
+	UserFixesPerMinute    int
+	ChannelFixesPerMinute int
+	GuildFixesPerMinute   int
+
+	// RateLimitAction controls what happens to fixes over the rate limits.
+	// Empty means RateLimitCoalesce.
+	RateLimitAction RateLimitAction
+
+	// DuplicateWindow is how long a fixed link is remembered in a channel,
+	// so that reposts of the link in that time are not fixed again. Zero
+	// means DefaultDuplicateWindow, and a negative value disables it.
+	DuplicateWindow time.Duration
+
+	// FixBotMessages and FixWebhookMessages fix links in messages from other
+	// bots and from webhooks, which are ignored by default to avoid loops
+	// with other bots.
+	FixBotMessages     bool
+	FixWebhookMessages bool
+
+	// IgnoredUserIDs and IgnoredRoleIDs are users, and members with roles,
+	// whose messages are ignored.
+	IgnoredUserIDs []string
+	IgnoredRoleIDs []string
+
+	// CheckLinks checks that fixed links are up before posting them, falling
+	// back to the next of a FallbackFixer's fixers if not.
+	CheckLinks bool
+}
+
+// DefaultDuplicateWindow is the duplicate window used when
+// GuildSettings.DuplicateWindow is zero.
+const DefaultDuplicateWindow = 10 * time.Minute
+
+// EffectiveDuplicateWindow returns s.DuplicateWindow, or its default if it is
+// unset. It is negative if duplicates are not skipped.
+func (s GuildSettings) EffectiveDuplicateWindow() time.Duration {
+	if s.DuplicateWindow == 0 {
+		return DefaultDuplicateWindow
+	}
+	return s.DuplicateWindow
+}
+
+// A RateLimitAction controls what happens to fixes over the rate limits.
+type RateLimitAction string
+
+const (
+	// RateLimitCoalesce posts the fixes over the limits together in a single
+	// message, as long as one more message is allowed.
+	RateLimitCoalesce RateLimitAction = "coalesce"
+	// RateLimitDrop does not post fixes over the limits.
+	RateLimitDrop RateLimitAction = "drop"
+)
+
+// Default rate limits, used when the corresponding settings are zero.
+const (
+	DefaultUserFixesPerMinute    = 5
+	DefaultChannelFixesPerMinute = 10
+	DefaultGuildFixesPerMinute   = 30
+)
+
+// EffectiveRateLimitAction returns s.RateLimitAction, or its default if it is
+// unset.
+func (s GuildSettings) EffectiveRateLimitAction() RateLimitAction {
+	if s.RateLimitAction == "" {
+		return RateLimitCoalesce
+	}
+	return s.RateLimitAction
+}
+
+// effectiveLimit returns limit, or def if it is unset.
+func effectiveLimit(limit int, def int) int {
+	if limit == 0 {
+		return def
+	}
+	return limit
+}
+
+// EffectiveUserFixesPerMinute returns s.UserFixesPerMinute, or its default if
+// it is unset. It is negative if there is no limit.
+func (s GuildSettings) EffectiveUserFixesPerMinute() int {
+	return effectiveLimit(s.UserFixesPerMinute, DefaultUserFixesPerMinute)
+}
+
+// EffectiveChannelFixesPerMinute returns s.ChannelFixesPerMinute, or its
+// default if it is unset. It is negative if there is no limit.
+func (s GuildSettings) EffectiveChannelFixesPerMinute() int {
+	return effectiveLimit(s.ChannelFixesPerMinute, DefaultChannelFixesPerMinute)
+}
+
+// EffectiveGuildFixesPerMinute returns s.GuildFixesPerMinute, or its default
+// if it is unset. It is negative if there is no limit.
+func (s GuildSettings) EffectiveGuildFixesPerMinute() int {
+	return effectiveLimit(s.GuildFixesPerMinute, DefaultGuildFixesPerMinute)
+}
+
+// EffectiveReplyMode returns s.ReplyMode, or its default if it is unset.
+func (s GuildSettings) EffectiveReplyMode() ReplyMode {
+	if s.ReplyMode == "" {
+		return ReplyModeReply
+	}
+	return s.ReplyMode
+}
+
+// Validate checks that s holds valid values.
+func (s GuildSettings) Validate() error {
+	if s.LogChannelID != "" && !snowflakeRegex.MatchString(s.LogChannelID) {
+		return fmt.Errorf("invalid log channel ID %q", s.LogChannelID)
+	}
+
+	switch s.ReplyMode {
+	case "", ReplyModeReply, ReplyModeChannel:
+	default:
+		return fmt.Errorf("invalid reply mode %q (should be %q or %q)", s.ReplyMode, ReplyModeReply, ReplyModeChannel)
+	}
+
+	for _, id := range slices.Concat(s.IgnoredUserIDs, s.IgnoredRoleIDs) {
+		if !snowflakeRegex.MatchString(id) {
+			return fmt.Errorf("invalid user or role ID %q", id)
+		}
+	}
+
+	switch s.RateLimitAction {
+	case "", RateLimitCoalesce, RateLimitDrop:
+	default:
+		return fmt.Errorf("invalid rate limit action %q (should be %q or %q)", s.RateLimitAction, RateLimitCoalesce, RateLimitDrop)
+	}
+
+	return nil
+}
+
+var snowflakeRegex = regexp.MustCompile(`^[0-9]+$`)
+
+// A Setting describes a single field of GuildSettings, so that settings can
+// be viewed and changed generically. New settings are added by appending to
+// Settings.
+type Setting struct {
+	Name        string
+	Description string
+
+	// Get formats the setting's value in s for display.
+	Get func(s GuildSettings) string
+	// Set parses value and stores it in s.
+	Set func(s *GuildSettings, value string) error
+	// Reset restores the setting's default value in s.
+	Reset func(s *GuildSettings)
+}
+
+// Settings lists every guild setting.
+var Settings = []Setting{
+	{
+		Name:        "log-channel",
+		Description: "Channel fixer configuration changes are announced in (none to disable)",
+		Get: func(s GuildSettings) string {
+			if s.LogChannelID == "" {
+				return "none"
+			}
+			return fmt.Sprintf("<#%v>", s.LogChannelID)
+		},
+		Set: func(s *GuildSettings, value string) error {
+			if value == "none" {
+				s.LogChannelID = ""
+				return nil
+			}
+			s.LogChannelID = strings.TrimSuffix(strings.TrimPrefix(value, "<#"), ">")
+			return nil
+		},
+		Reset: func(s *GuildSettings) { s.LogChannelID = "" },
+	},
+	{
+		Name:        "ignore-global-fixers",
+		Description: "Whether the bot's default fixers are ignored in this server",
+		Get:         func(s GuildSettings) string { return strconv.FormatBool(s.IgnoreGlobalFixers) },
+		Set:         boolSetter(func(s *GuildSettings) *bool { return &s.IgnoreGlobalFixers }),
+		Reset:       func(s *GuildSettings) { s.IgnoreGlobalFixers = false },
+	},
+	{
+		Name:        "reply-mode",
+		Description: fmt.Sprintf("How fixed links are posted: %q to the message or as a %q message", ReplyModeReply, ReplyModeChannel),
+		Get:         func(s GuildSettings) string { return string(s.EffectiveReplyMode()) },
+		Set: func(s *GuildSettings, value string) error {
+			s.ReplyMode = ReplyMode(value)
+			return nil
+		},
+		Reset: func(s *GuildSettings) { s.ReplyMode = "" },
+	},
+	{
+		Name:        "keep-query-params",
+		Description: "Whether query parameters are kept on fixed links instead of being stripped",
+		Get:         func(s GuildSettings) string { return strconv.FormatBool(s.KeepQueryParams) },
+		Set:         boolSetter(func(s *GuildSettings) *bool { return &s.KeepQueryParams }),
+		Reset:       func(s *GuildSettings) { s.KeepQueryParams = false },
+	},
+	{
+		Name:        "suppress-mentions",
+		Description: "Whether replies with fixed links do not ping the original author",
+		Get:         func(s GuildSettings) string { return strconv.FormatBool(s.SuppressMentions) },
+		Set:         boolSetter(func(s *GuildSettings) *bool { return &s.SuppressMentions }),
+		Reset:       func(s *GuildSettings) { s.SuppressMentions = false },
+	},
+	{
+		Name:        "private-manual-fixes",
+		Description: "Whether links fixed with the \"Fix links\" app are only shown to the user who asked",
+		Get:         func(s GuildSettings) string { return strconv.FormatBool(s.PrivateManualFixes) },
+		Set:         boolSetter(func(s *GuildSettings) *bool { return &s.PrivateManualFixes }),
+		Reset:       func(s *GuildSettings) { s.PrivateManualFixes = false },
+	},
+	{
+		Name:        "user-fixes-per-minute",
+		Description: fmt.Sprintf("How many fixed link messages are posted per minute for each user, or unlimited (default %v)", DefaultUserFixesPerMinute),
+		Get:         func(s GuildSettings) string { return formatLimit(s.EffectiveUserFixesPerMinute()) },
+		Set:         limitSetter(func(s *GuildSettings) *int { return &s.UserFixesPerMinute }),
+		Reset:       func(s *GuildSettings) { s.UserFixesPerMinute = 0 },
+	},
+	{
+		Name:        "channel-fixes-per-minute",
+		Description: fmt.Sprintf("How many fixed link messages are posted per minute in each channel, or unlimited (default %v)", DefaultChannelFixesPerMinute),
+		Get:         func(s GuildSettings) string { return formatLimit(s.EffectiveChannelFixesPerMinute()) },
+		Set:         limitSetter(func(s *GuildSettings) *int { return &s.ChannelFixesPerMinute }),
+		Reset:       func(s *GuildSettings) { s.ChannelFixesPerMinute = 0 },
+	},
+	{
+		Name:        "server-fixes-per-minute",
+		Description: fmt.Sprintf("How many fixed link messages are posted per minute in the whole server, or unlimited (default %v)", DefaultGuildFixesPerMinute),
+		Get:         func(s GuildSettings) string { return formatLimit(s.EffectiveGuildFixesPerMinute()) },
+		Set:         limitSetter(func(s *GuildSettings) *int { return &s.GuildFixesPerMinute }),
+		Reset:       func(s *GuildSettings) { s.GuildFixesPerMinute = 0 },
+	},
+	{
+		Name:        "rate-limit-action",
+		Description: fmt.Sprintf("What happens to fixes over the rate limits: %q them into one message or %q them", RateLimitCoalesce, RateLimitDrop),
+		Get:         func(s GuildSettings) string { return string(s.EffectiveRateLimitAction()) },
+		Set: func(s *GuildSettings, value string) error {
+			s.RateLimitAction = RateLimitAction(value)
+			return nil
+		},
+		Reset: func(s *GuildSettings) { s.RateLimitAction = "" },
+	},
+	{
+		Name:        "duplicate-window",
+		Description: fmt.Sprintf("How long links fixed in a channel are not fixed again when reposted, e.g. 30m, or off (default %v)", DefaultDuplicateWindow),
+		Get: func(s GuildSettings) string {
+			if s.EffectiveDuplicateWindow() < 0 {
+				return "off"
+			}
+			return s.EffectiveDuplicateWindow().String()
+		},
+		Set: func(s *GuildSettings, value string) error {
+			if value == "off" {
+				s.DuplicateWindow = -1
+				return nil
+			}
+
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid duration %q (should be e.g. 30m or off)", value)
+			}
+			s.DuplicateWindow = d
+			return nil
+		},
+		Reset: func(s *GuildSettings) { s.DuplicateWindow = 0 },
+	},
+	{
+		Name:        "fix-bot-messages",
+		Description: "Whether links in other bots' messages are fixed",
+		Get:         func(s GuildSettings) string { return strconv.FormatBool(s.FixBotMessages) },
+		Set:         boolSetter(func(s *GuildSettings) *bool { return &s.FixBotMessages }),
+		Reset:       func(s *GuildSettings) { s.FixBotMessages = false },
+	},
+	{
+		Name:        "fix-webhook-messages",
+		Description: "Whether links in webhook messages, e.g. from feeds, are fixed",
+		Get:         func(s GuildSettings) string { return strconv.FormatBool(s.FixWebhookMessages) },
+		Set:         boolSetter(func(s *GuildSettings) *bool { return &s.FixWebhookMessages }),
+		Reset:       func(s *GuildSettings) { s.FixWebhookMessages = false },
+	},
+	{
+		Name:        "ignored-users",
+		Description: "Users whose messages are ignored, as space-separated mentions or IDs (none to clear)",
+		Get:         func(s GuildSettings) string { return formatMentions("<@%v>", s.IgnoredUserIDs) },
+		Set:         mentionsSetter(func(s *GuildSettings) *[]string { return &s.IgnoredUserIDs }),
+		Reset:       func(s *GuildSettings) { s.IgnoredUserIDs = nil },
+	},
+	{
+		Name:        "ignored-roles",
+		Description: "Roles whose members' messages are ignored, as space-separated mentions or IDs (none to clear)",
+		Get:         func(s GuildSettings) string { return formatMentions("<@&%v>", s.IgnoredRoleIDs) },
+		Set:         mentionsSetter(func(s *GuildSettings) *[]string { return &s.IgnoredRoleIDs }),
+		Reset:       func(s *GuildSettings) { s.IgnoredRoleIDs = nil },
+	},
+	{
+		Name:        "check-links",
+		Description: "Whether fixed links are checked to be up before posting, trying fallback fixers if not",
+		Get:         func(s GuildSettings) string { return strconv.FormatBool(s.CheckLinks) },
+		Set:         boolSetter(func(s *GuildSettings) *bool { return &s.CheckLinks }),
+		Reset:       func(s *GuildSettings) { s.CheckLinks = false },
+	},
+}
+
+// LookupSetting returns the setting with the given name.
+func LookupSetting(name string) (Setting, bool) {
+	for _, setting := range Settings {
+		if setting.Name == name {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+// boolSetter returns a Setting.Set function for the bool field returned by
+// field.
+func boolSetter(field func(s *GuildSettings) *bool) func(s *GuildSettings, value string) error {
+	return func(s *GuildSettings, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q (should be true or false)", value)
+		}
+		*field(s) = b
+		return nil
+	}
+}
+
+// unlimited is how a rate limit setting with no limit is displayed and set.
+const unlimited = "unlimited"
+
+func formatLimit(limit int) string {
+	if limit < 0 {
+		return unlimited
+	}
+	return strconv.Itoa(limit)
+}
+
+// limitSetter returns a Setting.Set function for the rate limit field
+// returned by field.
+func limitSetter(field func(s *GuildSettings) *int) func(s *GuildSettings, value string) error {
+	return func(s *GuildSettings, value string) error {
+		if value == unlimited {
+			*field(s) = -1
+			return nil
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid limit %q (should be a positive number or %v)", value, unlimited)
+		}
+		*field(s) = n
+		return nil
+	}
+}
+
+// formatMentions formats ids as mentions using format, or "none" if there
+// are none.
+func formatMentions(format string, ids []string) string {
+	if len(ids) == 0 {
+		return "none"
+	}
+
+	var mentions []string
+	for _, id := range ids {
+		mentions = append(mentions, fmt.Sprintf(format, id))
+	}
+	return strings.Join(mentions, " ")
+}
+
+// mentionRegex matches a user, member or role mention, capturing its ID.
+var mentionRegex = regexp.MustCompile(`^<@[!&]?([0-9]+)>$`)
+
+// mentionsSetter returns a Setting.Set function for the list of IDs returned
+// by field. Values are space or comma separated IDs or mentions.
+func mentionsSetter(field func(s *GuildSettings) *[]string) func(s *GuildSettings, value string) error {
+	return func(s *GuildSettings, value string) error {
+		if value == "none" {
+			*field(s) = nil
+			return nil
+		}
+
+		var ids []string
+		for _, mention := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }) {
+			if match := mentionRegex.FindStringSubmatch(mention); match != nil {
+				mention = match[1]
+			}
+			ids = append(ids, mention)
+		}
+		*field(s) = ids
+		return nil
+	}
+}
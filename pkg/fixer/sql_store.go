@@ -0,0 +1,606 @@
+package fixer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// A sqlDialect describes the differences between the SQL databases
+// supported by SQLStore.
+type sqlDialect struct {
+	blobType   string
+	serialType string
+
+	// migrationLock, if set, is run at the start of the migration
+	// transaction to stop other instances migrating at the same time.
+	// SQLite needs none, as the transaction's first statement takes the
+	// database's write lock.
+	migrationLock string
+
+	// placeholder returns the bind parameter for the nth (1-indexed) argument.
+	placeholder func(n int) string
+}
+
+var sqlDialects = map[string]sqlDialect{
+	"sqlite": {
+		blobType:    "BLOB",
+		serialType:  "INTEGER PRIMARY KEY AUTOINCREMENT",
+		placeholder: func(int) string { return "?" },
+	},
+	"pgx": {
+		blobType:    "BYTEA",
+		serialType:  "BIGSERIAL PRIMARY KEY",
+		placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		// The key is arbitrary, but must be the same for every instance.
+		migrationLock: `SELECT pg_advisory_xact_lock(4823917)`,
+	},
+}
+
+// sqlMigrations are applied in order to bring a database up to the latest
+// schema. Entries must never be modified or removed once released; add a new
+// migration instead.
+var sqlMigrations = []func(d sqlDialect) []string{
+	func(d sqlDialect) []string {
+		return []string{
+			`CREATE TABLE guilds (
+				guild_id TEXT PRIMARY KEY
+			)`,
+			fmt.Sprintf(`CREATE TABLE fixers (
+				guild_id TEXT NOT NULL REFERENCES guilds (guild_id),
+				domain TEXT NOT NULL,
+				fixer %v NOT NULL,
+				PRIMARY KEY (guild_id, domain)
+			)`, d.blobType),
+			fmt.Sprintf(`CREATE TABLE fixer_history (
+				id %v,
+				guild_id TEXT NOT NULL,
+				domain TEXT NOT NULL,
+				actor_id TEXT NOT NULL,
+				changed_at BIGINT NOT NULL,
+				old_fixer %v,
+				new_fixer %v
+			)`, d.serialType, d.blobType, d.blobType),
+			`CREATE INDEX fixer_history_guild_domain ON fixer_history (guild_id, domain)`,
+			fmt.Sprintf(`CREATE TABLE guild_settings (
+				guild_id TEXT PRIMARY KEY,
+				settings %v NOT NULL
+			)`, d.blobType),
+		}
+	},
+	func(d sqlDialect) []string {
+		return []string{
+			`CREATE TABLE departed_guilds (
+				guild_id TEXT PRIMARY KEY,
+				departed_at BIGINT NOT NULL
+			)`,
+		}
+	},
+	func(d sqlDialect) []string {
+		return []string{
+			`ALTER TABLE fixer_history ADD COLUMN undo BOOLEAN NOT NULL DEFAULT FALSE`,
+		}
+	},
+}
+
+// SQLiteDSN returns the DSN for the SQLite database at path to open with
+// the "sqlite" driver. Connections wait for other connections' locks instead
+// of failing with SQLITE_BUSY, use WAL so that reads do not block writes, and
+// take the write lock when a writing transaction begins, so that several
+// connections or instances can share the database. Read-only transactions
+// only take a read lock, so reads never wait for writers.
+func SQLiteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+}
+
+// A SQLStore is a Store backed by a database/sql database.
+//
+// Supported drivers are "sqlite" (modernc.org/sqlite) and "pgx"
+// (github.com/jackc/pgx/v5/stdlib). The caller is responsible for
+// importing the driver.
+type SQLStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// NewSQLStore creates a SQLStore using db, which must have been opened with
+// driverName, and migrates it to the latest schema.
+func NewSQLStore(db *sql.DB, driverName string) (*SQLStore, error) {
+	dialect, ok := sqlDialects[driverName]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sql driver %v", driverName)
+	}
+
+	ss := &SQLStore{
+		db:      db,
+		dialect: dialect,
+	}
+
+	err := ss.migrate()
+	if err != nil {
+		return nil, fmt.Errorf("could not migrate database: %w", err)
+	}
+
+	return ss, nil
+}
+
+// query rewrites the ? placeholders in q into the dialect's bind parameters.
+func (ss *SQLStore) query(q string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString(ss.dialect.placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// migrate applies the migrations the database is missing in a single
+// transaction, so that instances starting at the same time do not both
+// apply them.
+func (ss *SQLStore) migrate() error {
+	return ss.withTx(func(tx *sql.Tx) error {
+		if ss.dialect.migrationLock != "" {
+			_, err := tx.Exec(ss.dialect.migrationLock)
+			if err != nil {
+				return fmt.Errorf("could not lock database for migration: %w", err)
+			}
+		}
+
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+		if err != nil {
+			return err
+		}
+
+		var version int
+		err = tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+		if err != nil {
+			return err
+		}
+
+		for ; version < len(sqlMigrations); version++ {
+			for _, stmt := range sqlMigrations[version](ss.dialect) {
+				_, err = tx.Exec(stmt)
+				if err != nil {
+					return fmt.Errorf("migration %v failed: %w", version+1, err)
+				}
+			}
+
+			_, err = tx.Exec(ss.query(`INSERT INTO schema_migrations (version) VALUES (?)`), version+1)
+			if err != nil {
+				return err
+			}
+			log.Info("applying database migration", "version", version+1)
+		}
+
+		return nil
+	})
+}
+
+// withTx runs fn in a transaction, committing if it returns nil. On SQLite,
+// the transaction takes the write lock when it begins.
+func (ss *SQLStore) withTx(fn func(tx *sql.Tx) error) error {
+	return ss.runTx(nil, fn)
+}
+
+// withReadTx runs fn in a read-only transaction, which on SQLite does not
+// take the write lock, so that reads do not wait for writers or each other.
+func (ss *SQLStore) withReadTx(fn func(tx *sql.Tx) error) error {
+	return ss.runTx(&sql.TxOptions{ReadOnly: true}, fn)
+}
+
+func (ss *SQLStore) runTx(opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	tx, err := ss.db.BeginTx(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ss *SQLStore) guildExists(tx *sql.Tx, guildID string) (bool, error) {
+	var n int
+	err := tx.QueryRow(ss.query(`SELECT COUNT(*) FROM guilds WHERE guild_id = ?`), guildID).Scan(&n)
+	return n > 0, err
+}
+
+// getFixer returns the fixer for domain, or nil if there is none.
+func (ss *SQLStore) getFixer(tx *sql.Tx, guildID string, domain string) (Fixer, error) {
+	var fEncoded []byte
+	err := tx.QueryRow(ss.query(`SELECT fixer FROM fixers WHERE guild_id = ? AND domain = ?`), guildID, domain).Scan(&fEncoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeFixer(fEncoded)
+}
+
+func (ss *SQLStore) recordChange(tx *sql.Tx, c Change) error {
+	var oldEncoded, newEncoded []byte
+	var err error
+	if c.Old != nil {
+		oldEncoded, err = encodeFixer(c.Old)
+		if err != nil {
+			return err
+		}
+	}
+	if c.New != nil {
+		newEncoded, err = encodeFixer(c.New)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		ss.query(`INSERT INTO fixer_history (guild_id, domain, actor_id, changed_at, old_fixer, new_fixer, undo) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		c.GuildID, c.Domain, c.ActorID, c.Time.UnixNano(), oldEncoded, newEncoded, c.Undo,
+	)
+	return err
+}
+
+func (ss *SQLStore) Put(guildID string, domain string, f Fixer, actorID string) (Change, error) {
+	return ss.put(guildID, domain, f, actorID, false)
+}
+
+func (ss *SQLStore) Undo(c Change, actorID string) (Change, bool, error) {
+	if c.Old == nil {
+		return ss.delete(c.GuildID, c.Domain, actorID, true)
+	}
+	change, err := ss.put(c.GuildID, c.Domain, c.Old, actorID, true)
+	return change, err == nil, err
+}
+
+func (ss *SQLStore) put(guildID string, domain string, f Fixer, actorID string, undo bool) (Change, error) {
+	var c Change
+	err := ss.withTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(ss.query(`INSERT INTO guilds (guild_id) VALUES (?) ON CONFLICT (guild_id) DO NOTHING`), guildID)
+		if err != nil {
+			return err
+		}
+
+		old, err := ss.getFixer(tx, guildID, domain)
+		if err != nil {
+			return err
+		}
+
+		fEncoded, err := encodeFixer(f)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			ss.query(`INSERT INTO fixers (guild_id, domain, fixer) VALUES (?, ?, ?) ON CONFLICT (guild_id, domain) DO UPDATE SET fixer = excluded.fixer`),
+			guildID, domain, fEncoded,
+		)
+		if err != nil {
+			return err
+		}
+
+		log.Info("created fixer", "guildID", guildID, "domain", domain, "fixer", f, "actorID", actorID)
+		c = Change{
+			GuildID: guildID,
+			Domain:  domain,
+			ActorID: actorID,
+			Time:    time.Now(),
+			Old:     old,
+			New:     f,
+			Undo:    undo,
+		}
+		return ss.recordChange(tx, c)
+	})
+	if err != nil {
+		return Change{}, err
+	}
+
+	return c, nil
+}
+
+func (ss *SQLStore) Get(guildID string, domain string) (Fixer, error) {
+	var res Fixer
+	err := ss.withReadTx(func(tx *sql.Tx) error {
+		exists, err := ss.guildExists(tx, guildID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("could not find guild %v: %w", guildID, ErrGuildNotFound)
+		}
+
+		res, err = ss.getFixer(tx, guildID, domain)
+		if err != nil {
+			return err
+		}
+		if res == nil {
+			return fmt.Errorf("could not find fixer for %v: %w", domain, ErrNotFound)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (ss *SQLStore) Delete(guildID string, domain string, actorID string) (Change, bool, error) {
+	return ss.delete(guildID, domain, actorID, false)
+}
+
+func (ss *SQLStore) delete(guildID string, domain string, actorID string, undo bool) (Change, bool, error) {
+	var c Change
+	deleted := false
+	err := ss.withTx(func(tx *sql.Tx) error {
+		old, err := ss.getFixer(tx, guildID, domain)
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			return nil
+		}
+
+		_, err = tx.Exec(ss.query(`DELETE FROM fixers WHERE guild_id = ? AND domain = ?`), guildID, domain)
+		if err != nil {
+			return err
+		}
+
+		log.Info("deleted fixer", "guildID", guildID, "domain", domain, "actorID", actorID)
+		deleted = true
+		c = Change{
+			GuildID: guildID,
+			Domain:  domain,
+			ActorID: actorID,
+			Time:    time.Now(),
+			Old:     old,
+			Undo:    undo,
+		}
+		return ss.recordChange(tx, c)
+	})
+	if err != nil {
+		return Change{}, false, err
+	}
+
+	return c, deleted, nil
+}
+
+func (ss *SQLStore) List(guildID string) (map[string]Fixer, error) {
+	res := map[string]Fixer{}
+	err := ss.withReadTx(func(tx *sql.Tx) error {
+		exists, err := ss.guildExists(tx, guildID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("could not find guild %v: %w", guildID, ErrGuildNotFound)
+		}
+
+		rows, err := tx.Query(ss.query(`SELECT domain, fixer FROM fixers WHERE guild_id = ?`), guildID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var domain string
+			var fEncoded []byte
+			err = rows.Scan(&domain, &fEncoded)
+			if err != nil {
+				return err
+			}
+
+			f, err := decodeFixer(fEncoded)
+			if err != nil {
+				return err
+			}
+			res[domain] = f
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (ss *SQLStore) History(guildID string, domain string) ([]Change, error) {
+	q := `SELECT domain, actor_id, changed_at, old_fixer, new_fixer, undo FROM fixer_history WHERE guild_id = ?`
+	args := []any{guildID}
+	if domain != "" {
+		q += ` AND domain = ?`
+		args = append(args, domain)
+	}
+	q += ` ORDER BY id DESC`
+
+	rows, err := ss.db.Query(ss.query(q), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []Change
+	for rows.Next() {
+		c := Change{GuildID: guildID}
+		var changedAt int64
+		var oldEncoded, newEncoded []byte
+		err = rows.Scan(&c.Domain, &c.ActorID, &changedAt, &oldEncoded, &newEncoded, &c.Undo)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Time = time.Unix(0, changedAt)
+		if oldEncoded != nil {
+			c.Old, err = decodeFixer(oldEncoded)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if newEncoded != nil {
+			c.New, err = decodeFixer(newEncoded)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (ss *SQLStore) GetSettings(guildID string) (GuildSettings, error) {
+	var sEncoded []byte
+	err := ss.db.QueryRow(ss.query(`SELECT settings FROM guild_settings WHERE guild_id = ?`), guildID).Scan(&sEncoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return GuildSettings{}, nil
+	}
+	if err != nil {
+		return GuildSettings{}, err
+	}
+
+	return decodeSettings(sEncoded)
+}
+
+func (ss *SQLStore) PutSettings(guildID string, settings GuildSettings) error {
+	sEncoded, err := encodeSettings(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.db.Exec(
+		ss.query(`INSERT INTO guild_settings (guild_id, settings) VALUES (?, ?) ON CONFLICT (guild_id) DO UPDATE SET settings = excluded.settings`),
+		guildID, sEncoded,
+	)
+	if err != nil {
+		return err
+	}
+
+	log.Info("updated settings", "guildID", guildID, "settings", settings)
+	return nil
+}
+
+func (ss *SQLStore) MarkDeparted(guildID string, at time.Time) error {
+	if at.IsZero() {
+		_, err := ss.db.Exec(ss.query(`DELETE FROM departed_guilds WHERE guild_id = ?`), guildID)
+		return err
+	}
+
+	_, err := ss.db.Exec(
+		ss.query(`INSERT INTO departed_guilds (guild_id, departed_at) VALUES (?, ?) ON CONFLICT (guild_id) DO UPDATE SET departed_at = excluded.departed_at`),
+		guildID, at.UnixNano(),
+	)
+	return err
+}
+
+func (ss *SQLStore) Departed() (map[string]time.Time, error) {
+	rows, err := ss.db.Query(`SELECT guild_id, departed_at FROM departed_guilds`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[string]time.Time{}
+	for rows.Next() {
+		var guildID string
+		var departedAt int64
+		err = rows.Scan(&guildID, &departedAt)
+		if err != nil {
+			return nil, err
+		}
+		res[guildID] = time.Unix(0, departedAt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (ss *SQLStore) Purge(guildID string) error {
+	return ss.withTx(func(tx *sql.Tx) error {
+		for _, table := range []string{"fixers", "guilds", "fixer_history", "guild_settings", "departed_guilds"} {
+			_, err := tx.Exec(ss.query(`DELETE FROM `+table+` WHERE guild_id = ?`), guildID)
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Info("purged guild", "guildID", guildID)
+		return nil
+	})
+}
+
+func (ss *SQLStore) Guilds() ([]string, error) {
+	rows, err := ss.db.Query(`SELECT guild_id FROM guilds
+		UNION SELECT guild_id FROM fixer_history
+		UNION SELECT guild_id FROM guild_settings
+		UNION SELECT guild_id FROM departed_guilds
+		ORDER BY guild_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var guildID string
+		err = rows.Scan(&guildID)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, guildID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (ss *SQLStore) Sizes() (map[string]int, error) {
+	rows, err := ss.db.Query(`SELECT guilds.guild_id, COUNT(fixers.domain) FROM guilds LEFT JOIN fixers ON fixers.guild_id = guilds.guild_id GROUP BY guilds.guild_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[string]int{}
+	for rows.Next() {
+		var guildID string
+		var n int
+		err = rows.Scan(&guildID, &n)
+		if err != nil {
+			return nil, err
+		}
+		res[guildID] = n
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
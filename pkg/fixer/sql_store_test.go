@@ -0,0 +1,161 @@
+package fixer_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer/storetest"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// postgresDSNEnv names the environment variable holding the DSN of a
+// Postgres database to run the tests against. Its tables are dropped.
+const postgresDSNEnv = "LINKFIXER_TEST_POSTGRES_DSN"
+
+func openSQLite(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", fixer.SQLiteDSN(path))
+	if err != nil {
+		t.Fatalf("could not open sqlite db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLStoreSQLite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) fixer.Store {
+		ss, err := fixer.NewSQLStore(openSQLite(t, filepath.Join(t.TempDir(), "fixers.db")), "sqlite")
+		if err != nil {
+			t.Fatalf("could not create store: %v", err)
+		}
+		return ss
+	})
+}
+
+func TestSQLStoreSQLiteSharedByInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixers.db")
+
+	// Instances starting together must not both apply the migrations, and
+	// must not fail on each other's locks.
+	const instances = 4
+	stores := make([]*fixer.SQLStore, instances)
+	errs := make([]error, instances)
+	var wg sync.WaitGroup
+	for n := range instances {
+		db := openSQLite(t, path)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stores[n], errs[n] = fixer.NewSQLStore(db, "sqlite")
+		}()
+	}
+	wg.Wait()
+	for n, err := range errs {
+		if err != nil {
+			t.Fatalf("instance %v could not create store: %v", n, err)
+		}
+	}
+
+	putErrs := make(chan error, instances*10)
+	for n, ss := range stores {
+		for m := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				domain := fmt.Sprintf("example%v-%v.com", n, m)
+				_, err := ss.Put("123456789", domain, fixer.PrependFixer{Prefix: "https://fixed/"}, "111111111")
+				if err == nil {
+					_, err = ss.List("123456789")
+				}
+				putErrs <- err
+			}()
+		}
+	}
+	wg.Wait()
+	close(putErrs)
+	for err := range putErrs {
+		if err != nil {
+			t.Fatalf("concurrent Put failed: %v", err)
+		}
+	}
+
+	fixers, err := stores[0].List("123456789")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(fixers) != instances*10 {
+		t.Errorf("got %v fixers, want %v", len(fixers), instances*10)
+	}
+}
+
+func TestSQLStoreSQLiteReadsDoNotWaitForWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixers.db")
+	ss, err := fixer.NewSQLStore(openSQLite(t, path), "sqlite")
+	if err != nil {
+		t.Fatalf("could not create store: %v", err)
+	}
+	want := fixer.PrependFixer{Prefix: "https://fixed/"}
+	_, err = ss.Put("123456789", "example.com", want, "111111111")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// Another instance holds the write lock for longer than the busy
+	// timeout.
+	writer, err := openSQLite(t, path).Begin()
+	if err != nil {
+		t.Fatalf("could not begin write transaction: %v", err)
+	}
+	defer writer.Rollback()
+	_, err = writer.Exec(`INSERT INTO guilds (guild_id) VALUES ('987654321')`)
+	if err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+
+	start := time.Now()
+	got, err := ss.Get("123456789", "example.com")
+	if err != nil || got != want {
+		t.Errorf("Get = %v, %v, want %v", got, err, want)
+	}
+	fixers, err := ss.List("123456789")
+	if err != nil || len(fixers) != 1 {
+		t.Errorf("List = %v, %v, want 1 fixer", fixers, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("reads took %v while another instance was writing", elapsed)
+	}
+}
+
+func TestSQLStorePostgres(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%v not set", postgresDSNEnv)
+	}
+
+	storetest.Run(t, func(t *testing.T) fixer.Store {
+		db, err := sql.Open("pgx", dsn)
+		if err != nil {
+			t.Fatalf("could not open postgres db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		_, err = db.Exec(`DROP TABLE IF EXISTS schema_migrations, fixers, guilds, fixer_history, guild_settings, departed_guilds CASCADE`)
+		if err != nil {
+			t.Fatalf("could not drop tables: %v", err)
+		}
+
+		ss, err := fixer.NewSQLStore(db, "pgx")
+		if err != nil {
+			t.Fatalf("could not create store: %v", err)
+		}
+		return ss
+	})
+}
@@ -1,19 +1,67 @@
 package fixer
 
 import (
-	"bytes"
-	"encoding/gob"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/log"
 	bolt "go.etcd.io/bbolt"
 )
 
 type Store interface {
-	Put(guildID string, domain string, f Fixer) error
+	// Put sets the guild's fixer for domain, and returns the change it
+	// recorded.
+	Put(guildID string, domain string, f Fixer, actorID string) (Change, error)
+
+	// Get returns the guild's fixer for domain. It returns ErrGuildNotFound
+	// if the guild has never had a fixer and ErrNotFound if it has no fixer
+	// for domain.
 	Get(guildID string, domain string) (Fixer, error)
-	Delete(guildID string, domain string) error
+
+	// Delete deletes the guild's fixer for domain, and returns the change it
+	// recorded. It reports false if there was no fixer to delete.
+	Delete(guildID string, domain string, actorID string) (Change, bool, error)
+
+	// Undo reverts c, restoring the fixer it replaced or deleting the fixer
+	// it created, and returns the change it recorded, which has Undo set. c
+	// should be the change returned by LastUndoable. It reports false if the
+	// fixer was already deleted, so there was nothing to undo.
+	Undo(c Change, actorID string) (Change, bool, error)
+
+	// List returns all of the guild's fixers keyed by domain. It returns
+	// ErrGuildNotFound if the guild has never had a fixer.
 	List(guildID string) (map[string]Fixer, error)
+
+	// History returns the recorded changes to a guild's fixers, newest first.
+	// If domain is empty, changes to all domains are returned.
+	History(guildID string, domain string) ([]Change, error)
+
+	GetSettings(guildID string) (GuildSettings, error)
+	PutSettings(guildID string, settings GuildSettings) error
+
+	// MarkDeparted records that the bot left the guild at the given time.
+	// A zero time clears the mark, e.g. when the bot rejoins.
+	MarkDeparted(guildID string, at time.Time) error
+
+	// Departed returns the guilds the bot has left, with the time it left.
+	Departed() (map[string]time.Time, error)
+
+	// Purge deletes all of a guild's data: fixers, history, settings and
+	// departure mark.
+	Purge(guildID string) error
+
+	// Sizes returns the number of fixers stored for every guild with data,
+	// including GlobalScope.
+	Sizes() (map[string]int, error)
+
+	// Guilds returns every guild with any data stored: fixers, history,
+	// settings or a departure mark. It includes GlobalScope and user scopes.
+	Guilds() ([]string, error)
 }
 
 type FixerList []struct {
@@ -21,6 +69,23 @@ type FixerList []struct {
 	Fixer  Fixer
 }
 
+// historyBucket is the top-level bucket holding one nested bucket of
+// changes per guild. Guild IDs are numeric, so it cannot collide with them.
+var historyBucket = []byte("_history")
+
+// settingsBucket is the top-level bucket holding each guild's settings.
+var settingsBucket = []byte("_settings")
+
+// departedBucket is the top-level bucket holding the time the bot left each
+// guild it is no longer in.
+var departedBucket = []byte("_departed")
+
+// isReservedBucket reports whether name is a top-level bucket used for
+// something other than a guild's fixers.
+func isReservedBucket(name []byte) bool {
+	return strings.HasPrefix(string(name), "_") && string(name) != GlobalScope
+}
+
 type BoltStore struct {
 	db *bolt.DB
 }
@@ -31,49 +96,109 @@ func NewBoltStore(db *bolt.DB) *BoltStore {
 	}
 }
 
-func (bs *BoltStore) encodeFixer(f Fixer) ([]byte, error) {
-	b := bytes.Buffer{}
-	err := gob.NewEncoder(&b).Encode(&f)
+// recordChange appends c to the history of its guild within tx.
+func (bs *BoltStore) recordChange(tx *bolt.Tx, c Change) error {
+	hb, err := tx.CreateBucketIfNotExists(historyBucket)
 	if err != nil {
-		log.Error("could not encode fixer", "fixer", f, "err", err)
-		return nil, err
+		return err
 	}
 
-	log.Debug("encoded fixer", "encoded", b.Bytes())
+	b, err := hb.CreateBucketIfNotExists([]byte(c.GuildID))
+	if err != nil {
+		return err
+	}
 
-	return b.Bytes(), nil
-}
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
 
-func (bs *BoltStore) decodeFixer(b []byte) (Fixer, error) {
-	var f Fixer
-	err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(&f)
+	cEncoded, err := encodeChange(c)
 	if err != nil {
-		log.Error("could not decode fixer", "err", err)
-		return nil, err
+		return err
 	}
 
-	return f, nil
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return b.Put(key, cEncoded)
 }
 
-func (bs *BoltStore) Delete(guildID string, domain string) error {
-	return bs.db.Update(func(tx *bolt.Tx) error {
+func (bs *BoltStore) Delete(guildID string, domain string, actorID string) (Change, bool, error) {
+	return bs.delete(guildID, domain, actorID, false)
+}
+
+func (bs *BoltStore) delete(guildID string, domain string, actorID string, undo bool) (Change, bool, error) {
+	var c Change
+	deleted := false
+	err := bs.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(guildID))
 		if b == nil {
-			return fmt.Errorf("could not find bucket %v", guildID)
+			return nil
+		}
+
+		oldEncoded := b.Get([]byte(domain))
+		if oldEncoded == nil {
+			return nil
+		}
+
+		old, err := decodeFixer(oldEncoded)
+		if err != nil {
+			return err
+		}
+
+		err = b.Delete([]byte(domain))
+		if err != nil {
+			return err
 		}
 
-		return b.Delete([]byte(domain))
+		log.Info("deleted fixer", "guildID", guildID, "domain", domain, "actorID", actorID)
+		deleted = true
+		c = Change{
+			GuildID: guildID,
+			Domain:  domain,
+			ActorID: actorID,
+			Time:    time.Now(),
+			Old:     old,
+			Undo:    undo,
+		}
+		return bs.recordChange(tx, c)
 	})
+	if err != nil {
+		return Change{}, false, err
+	}
+
+	return c, deleted, nil
 }
 
-func (bs *BoltStore) Put(guildID string, domain string, f Fixer) error {
-	return bs.db.Update(func(tx *bolt.Tx) error {
+func (bs *BoltStore) Put(guildID string, domain string, f Fixer, actorID string) (Change, error) {
+	return bs.put(guildID, domain, f, actorID, false)
+}
+
+func (bs *BoltStore) Undo(c Change, actorID string) (Change, bool, error) {
+	if c.Old == nil {
+		return bs.delete(c.GuildID, c.Domain, actorID, true)
+	}
+	change, err := bs.put(c.GuildID, c.Domain, c.Old, actorID, true)
+	return change, err == nil, err
+}
+
+func (bs *BoltStore) put(guildID string, domain string, f Fixer, actorID string, undo bool) (Change, error) {
+	var c Change
+	err := bs.db.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(guildID))
 		if err != nil {
 			return err
 		}
 
-		fEncoded, err := bs.encodeFixer(f)
+		var old Fixer
+		if oldEncoded := b.Get([]byte(domain)); oldEncoded != nil {
+			old, err = decodeFixer(oldEncoded)
+			if err != nil {
+				return err
+			}
+		}
+
+		fEncoded, err := encodeFixer(f)
 		if err != nil {
 			return err
 		}
@@ -83,9 +208,23 @@ func (bs *BoltStore) Put(guildID string, domain string, f Fixer) error {
 			return err
 		}
 
-		log.Info("created fixer", "guildID", guildID, "domain", domain, "fixer", f)
-		return nil
+		log.Info("created fixer", "guildID", guildID, "domain", domain, "fixer", f, "actorID", actorID)
+		c = Change{
+			GuildID: guildID,
+			Domain:  domain,
+			ActorID: actorID,
+			Time:    time.Now(),
+			Old:     old,
+			New:     f,
+			Undo:    undo,
+		}
+		return bs.recordChange(tx, c)
 	})
+	if err != nil {
+		return Change{}, err
+	}
+
+	return c, nil
 }
 
 func (bs *BoltStore) Get(guildID string, domain string) (Fixer, error) {
@@ -93,14 +232,14 @@ func (bs *BoltStore) Get(guildID string, domain string) (Fixer, error) {
 	err := bs.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(guildID))
 		if b == nil {
-			return fmt.Errorf("could not find bucket %v", guildID)
+			return fmt.Errorf("could not find bucket %v: %w", guildID, ErrGuildNotFound)
 		}
 
 		fEncoded := b.Get([]byte(domain))
 		if fEncoded == nil {
-			return nil
+			return fmt.Errorf("could not find fixer for %v: %w", domain, ErrNotFound)
 		}
-		f, err := bs.decodeFixer(fEncoded)
+		f, err := decodeFixer(fEncoded)
 		if err != nil {
 			return err
 		}
@@ -120,11 +259,11 @@ func (bs *BoltStore) List(guildID string) (map[string]Fixer, error) {
 	err := bs.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(guildID))
 		if b == nil {
-			return fmt.Errorf("could not find bucket %v", guildID)
+			return fmt.Errorf("could not find bucket %v: %w", guildID, ErrGuildNotFound)
 		}
 
 		return b.ForEach(func(domain, fEncoded []byte) error {
-			f, err := bs.decodeFixer(fEncoded)
+			f, err := decodeFixer(fEncoded)
 			if err != nil {
 				return err
 			}
@@ -139,3 +278,213 @@ func (bs *BoltStore) List(guildID string) (map[string]Fixer, error) {
 
 	return res, nil
 }
+
+func (bs *BoltStore) History(guildID string, domain string) ([]Change, error) {
+	var res []Change
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		hb := tx.Bucket(historyBucket)
+		if hb == nil {
+			return nil
+		}
+
+		b := hb.Bucket([]byte(guildID))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, cEncoded := c.Last(); k != nil; k, cEncoded = c.Prev() {
+			change, err := decodeChange(cEncoded)
+			if err != nil {
+				return err
+			}
+
+			if domain != "" && change.Domain != domain {
+				continue
+			}
+			res = append(res, change)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (bs *BoltStore) GetSettings(guildID string) (GuildSettings, error) {
+	var res GuildSettings
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(settingsBucket)
+		if b == nil {
+			return nil
+		}
+
+		sEncoded := b.Get([]byte(guildID))
+		if sEncoded == nil {
+			return nil
+		}
+
+		settings, err := decodeSettings(sEncoded)
+		if err != nil {
+			return err
+		}
+
+		res = settings
+		return nil
+	})
+	if err != nil {
+		return GuildSettings{}, err
+	}
+
+	return res, nil
+}
+
+func (bs *BoltStore) PutSettings(guildID string, settings GuildSettings) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(settingsBucket)
+		if err != nil {
+			return err
+		}
+
+		sEncoded, err := encodeSettings(settings)
+		if err != nil {
+			return err
+		}
+
+		log.Info("updated settings", "guildID", guildID, "settings", settings)
+		return b.Put([]byte(guildID), sEncoded)
+	})
+}
+
+func (bs *BoltStore) MarkDeparted(guildID string, at time.Time) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(departedBucket)
+		if err != nil {
+			return err
+		}
+
+		if at.IsZero() {
+			return b.Delete([]byte(guildID))
+		}
+
+		atEncoded, err := at.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(guildID), atEncoded)
+	})
+}
+
+func (bs *BoltStore) Departed() (map[string]time.Time, error) {
+	res := map[string]time.Time{}
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(departedBucket)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(guildID, atEncoded []byte) error {
+			var at time.Time
+			err := at.UnmarshalBinary(atEncoded)
+			if err != nil {
+				return err
+			}
+
+			res[string(guildID)] = at
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (bs *BoltStore) Purge(guildID string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(guildID))
+		if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+
+		if hb := tx.Bucket(historyBucket); hb != nil {
+			err = hb.DeleteBucket([]byte(guildID))
+			if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+		}
+
+		for _, name := range [][]byte{settingsBucket, departedBucket} {
+			if b := tx.Bucket(name); b != nil {
+				err = b.Delete([]byte(guildID))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		log.Info("purged guild", "guildID", guildID)
+		return nil
+	})
+}
+
+func (bs *BoltStore) Guilds() ([]string, error) {
+	guilds := map[string]bool{}
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if !isReservedBucket(name) {
+				guilds[string(name)] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, name := range [][]byte{historyBucket, settingsBucket, departedBucket} {
+			b := tx.Bucket(name)
+			if b == nil {
+				continue
+			}
+
+			// History is kept in a bucket per guild, and settings and
+			// departures under a key per guild, so either way the keys
+			// are guild IDs.
+			err = b.ForEach(func(guildID, _ []byte) error {
+				guilds[string(guildID)] = true
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Sorted(maps.Keys(guilds)), nil
+}
+
+func (bs *BoltStore) Sizes() (map[string]int, error) {
+	res := map[string]int{}
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if isReservedBucket(name) {
+				return nil
+			}
+
+			res[string(name)] = b.Stats().KeyN
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,30 @@
+package fixer_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer/storetest"
+	"go.etcd.io/bbolt"
+)
+
+// IDs used by the tests in this package.
+const (
+	guildID = "123456789"
+	actorID = "111111111"
+)
+
+func newBoltStore(t *testing.T) fixer.Store {
+	t.Helper()
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "fixers.db"), 0600, &bbolt.Options{})
+	if err != nil {
+		t.Fatalf("could not open bolt db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return fixer.NewBoltStore(db)
+}
+
+func TestBoltStore(t *testing.T) {
+	storetest.Run(t, newBoltStore)
+}
@@ -0,0 +1,592 @@
+// Package storetest provides a conformance test suite that every
+// fixer.Store implementation must pass, so that backends are
+// interchangeable.
+//
+// In particular, it checks that missing guilds and fixers are reported with
+// fixer.ErrGuildNotFound and fixer.ErrNotFound, and that a guild stays known
+// after its last fixer is deleted.
+package storetest
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+const (
+	guildID      = "123456789"
+	otherGuildID = "987654321"
+	actorID      = "111111111"
+)
+
+// Run runs the conformance suite against stores created by newStore, which
+// must return a new, empty store each time it is called.
+func Run(t *testing.T, newStore func(t *testing.T) fixer.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s fixer.Store)
+	}{
+		{"PutGet", testPutGet},
+		{"PutOverwrite", testPutOverwrite},
+		{"GetMissingGuild", testGetMissingGuild},
+		{"GetMissingDomain", testGetMissingDomain},
+		{"Delete", testDelete},
+		{"DeleteMissingGuild", testDeleteMissingGuild},
+		{"DeleteMissingDomain", testDeleteMissingDomain},
+		{"EmptiedGuildStillExists", testEmptiedGuildStillExists},
+		{"List", testList},
+		{"ListMissingGuild", testListMissingGuild},
+		{"ListReturnsCopy", testListReturnsCopy},
+		{"GuildsAreIsolated", testGuildsAreIsolated},
+		{"History", testHistory},
+		{"HistoryDomainFilter", testHistoryDomainFilter},
+		{"Undo", testUndo},
+		{"WritesReturnRecordedChanges", testWritesReturnRecordedChanges},
+		{"Settings", testSettings},
+		{"Departed", testDeparted},
+		{"Purge", testPurge},
+		{"Sizes", testSizes},
+		{"Guilds", testGuilds},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func mustPut(t *testing.T, s fixer.Store, guildID string, domain string, f fixer.Fixer) {
+	t.Helper()
+	_, err := s.Put(guildID, domain, f, actorID)
+	if err != nil {
+		t.Fatalf("Put(%q, %q, %v) failed: %v", guildID, domain, f, err)
+	}
+}
+
+func testPutGet(t *testing.T, s fixer.Store) {
+	want := fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"}
+	mustPut(t, s, guildID, "twitter.com", want)
+
+	got, err := s.Get(guildID, "twitter.com")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !fixer.EqualFixers(got, want) {
+		t.Errorf("Get = %v, want %v", got, want)
+	}
+}
+
+func testPutOverwrite(t *testing.T, s fixer.Store) {
+	mustPut(t, s, guildID, "twitter.com", fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"})
+	want := fixer.PrependFixer{Prefix: "https://proxy/"}
+	mustPut(t, s, guildID, "twitter.com", want)
+
+	got, err := s.Get(guildID, "twitter.com")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !fixer.EqualFixers(got, want) {
+		t.Errorf("Get = %v, want %v", got, want)
+	}
+}
+
+func testGetMissingGuild(t *testing.T, s fixer.Store) {
+	_, err := s.Get(guildID, "twitter.com")
+	if !errors.Is(err, fixer.ErrGuildNotFound) {
+		t.Errorf("Get on missing guild returned %v, want ErrGuildNotFound", err)
+	}
+	if !errors.Is(err, fixer.ErrNotFound) {
+		t.Errorf("Get on missing guild returned %v, want ErrNotFound", err)
+	}
+}
+
+func testGetMissingDomain(t *testing.T, s fixer.Store) {
+	mustPut(t, s, guildID, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+
+	_, err := s.Get(guildID, "youtube.com")
+	if !errors.Is(err, fixer.ErrNotFound) {
+		t.Errorf("Get on missing domain returned %v, want ErrNotFound", err)
+	}
+	if errors.Is(err, fixer.ErrGuildNotFound) {
+		t.Errorf("Get on missing domain returned ErrGuildNotFound")
+	}
+}
+
+func testDelete(t *testing.T, s fixer.Store) {
+	mustPut(t, s, guildID, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+
+	_, deleted, err := s.Delete(guildID, "twitter.com", actorID)
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if !deleted {
+		t.Errorf("Delete reported nothing deleted")
+	}
+
+	_, err = s.Get(guildID, "twitter.com")
+	if !errors.Is(err, fixer.ErrNotFound) {
+		t.Errorf("Get after Delete returned %v, want ErrNotFound", err)
+	}
+}
+
+func testDeleteMissingGuild(t *testing.T, s fixer.Store) {
+	_, deleted, err := s.Delete(guildID, "twitter.com", actorID)
+	if err != nil {
+		t.Errorf("Delete on missing guild failed: %v", err)
+	}
+	if deleted {
+		t.Errorf("Delete on missing guild reported a deletion")
+	}
+}
+
+func testDeleteMissingDomain(t *testing.T, s fixer.Store) {
+	mustPut(t, s, guildID, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+
+	_, deleted, err := s.Delete(guildID, "youtube.com", actorID)
+	if err != nil {
+		t.Errorf("Delete on missing domain failed: %v", err)
+	}
+	if deleted {
+		t.Errorf("Delete on missing domain reported a deletion")
+	}
+
+	changes, err := s.History(guildID, "youtube.com")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Delete on missing domain recorded %v changes, want 0", len(changes))
+	}
+}
+
+func testEmptiedGuildStillExists(t *testing.T, s fixer.Store) {
+	mustPut(t, s, guildID, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+	_, _, err := s.Delete(guildID, "twitter.com", actorID)
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	_, err = s.Get(guildID, "twitter.com")
+	if errors.Is(err, fixer.ErrGuildNotFound) || !errors.Is(err, fixer.ErrNotFound) {
+		t.Errorf("Get on emptied guild returned %v, want ErrNotFound", err)
+	}
+
+	fixers, err := s.List(guildID)
+	if err != nil {
+		t.Errorf("List on emptied guild failed: %v", err)
+	}
+	if len(fixers) != 0 {
+		t.Errorf("List on emptied guild returned %v fixers, want 0", len(fixers))
+	}
+}
+
+func testList(t *testing.T, s fixer.Store) {
+	want := map[string]fixer.Fixer{
+		"twitter.com": fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"},
+		"reddit.com":  fixer.RegexpReplaceFixer{Pattern: `(www\.)?reddit\.com`, Replacement: "old.reddit.com"},
+		"youtube.com": fixer.PrependFixer{Prefix: "https://proxy/"},
+	}
+	for domain, f := range want {
+		mustPut(t, s, guildID, domain, f)
+	}
+
+	got, err := s.List(guildID)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Errorf("List returned %v fixers, want %v", len(got), len(want))
+	}
+	for domain, f := range want {
+		if !fixer.EqualFixers(got[domain], f) {
+			t.Errorf("List()[%q] = %v, want %v", domain, got[domain], f)
+		}
+	}
+}
+
+func testListMissingGuild(t *testing.T, s fixer.Store) {
+	_, err := s.List(guildID)
+	if !errors.Is(err, fixer.ErrGuildNotFound) {
+		t.Errorf("List on missing guild returned %v, want ErrGuildNotFound", err)
+	}
+}
+
+func testListReturnsCopy(t *testing.T, s fixer.Store) {
+	mustPut(t, s, guildID, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+
+	fixers, err := s.List(guildID)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	delete(fixers, "twitter.com")
+	fixers["youtube.com"] = fixer.PrependFixer{Prefix: "https://proxy/"}
+
+	_, err = s.Get(guildID, "twitter.com")
+	if err != nil {
+		t.Errorf("modifying List result deleted fixer from store: %v", err)
+	}
+	_, err = s.Get(guildID, "youtube.com")
+	if !errors.Is(err, fixer.ErrNotFound) {
+		t.Errorf("modifying List result added fixer to store: %v", err)
+	}
+}
+
+func testGuildsAreIsolated(t *testing.T, s fixer.Store) {
+	mustPut(t, s, guildID, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+	mustPut(t, s, otherGuildID, "youtube.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+
+	got, err := s.Get(otherGuildID, "twitter.com")
+	if !errors.Is(err, fixer.ErrNotFound) {
+		t.Errorf("fixer leaked into other guild: %v, %v", got, err)
+	}
+
+	fixers, err := s.List(guildID)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(fixers) != 1 {
+		t.Errorf("List returned %v fixers, want 1", len(fixers))
+	}
+}
+
+func testHistory(t *testing.T, s fixer.Store) {
+	first := fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"}
+	second := fixer.PrependFixer{Prefix: "https://proxy/"}
+	mustPut(t, s, guildID, "twitter.com", first)
+	mustPut(t, s, guildID, "twitter.com", second)
+	_, _, err := s.Delete(guildID, "twitter.com", actorID)
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	changes, err := s.History(guildID, "")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+
+	want := []fixer.Change{
+		{GuildID: guildID, Domain: "twitter.com", ActorID: actorID, Old: second, New: nil},
+		{GuildID: guildID, Domain: "twitter.com", ActorID: actorID, Old: first, New: second},
+		{GuildID: guildID, Domain: "twitter.com", ActorID: actorID, Old: nil, New: first},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("History returned %v changes, want %v", len(changes), len(want))
+	}
+	for n, c := range changes {
+		if c.Time.IsZero() {
+			t.Errorf("change %v has no time", n)
+		}
+		c.Time = want[n].Time
+		if c != want[n] {
+			t.Errorf("History()[%v] = %+v, want %+v", n, c, want[n])
+		}
+	}
+}
+
+func testHistoryDomainFilter(t *testing.T, s fixer.Store) {
+	mustPut(t, s, guildID, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+	mustPut(t, s, guildID, "youtube.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+
+	changes, err := s.History(guildID, "youtube.com")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Domain != "youtube.com" {
+		t.Errorf("History(%q) = %+v, want one change to youtube.com", "youtube.com", changes)
+	}
+
+	changes, err = s.History(otherGuildID, "")
+	if err != nil {
+		t.Fatalf("History on missing guild failed: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("History on missing guild returned %v changes, want 0", len(changes))
+	}
+}
+
+func testUndo(t *testing.T, s fixer.Store) {
+	first := fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"}
+	second := fixer.PrependFixer{Prefix: "https://proxy/"}
+	mustPut(t, s, guildID, "twitter.com", first)
+	mustPut(t, s, guildID, "twitter.com", second)
+
+	// Undoing twice steps back to before the fixer was created.
+	for _, want := range []fixer.Fixer{first, nil} {
+		changes, err := s.History(guildID, "twitter.com")
+		if err != nil {
+			t.Fatalf("History failed: %v", err)
+		}
+		last, ok := fixer.LastUndoable(changes)
+		if !ok {
+			t.Fatalf("LastUndoable(%+v) found nothing to undo", changes)
+		}
+		_, _, err = s.Undo(last, actorID)
+		if err != nil {
+			t.Fatalf("Undo(%+v) failed: %v", last, err)
+		}
+
+		got, err := s.Get(guildID, "twitter.com")
+		if want == nil {
+			if !errors.Is(err, fixer.ErrNotFound) {
+				t.Errorf("Get after undoing the creation = %v, %v, want ErrNotFound", got, err)
+			}
+		} else if err != nil || got != want {
+			t.Errorf("Get after undo = %v, %v, want %v", got, err, want)
+		}
+	}
+
+	changes, err := s.History(guildID, "twitter.com")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	want := []fixer.Change{
+		{GuildID: guildID, Domain: "twitter.com", ActorID: actorID, Old: first, New: nil, Undo: true},
+		{GuildID: guildID, Domain: "twitter.com", ActorID: actorID, Old: second, New: first, Undo: true},
+		{GuildID: guildID, Domain: "twitter.com", ActorID: actorID, Old: first, New: second},
+		{GuildID: guildID, Domain: "twitter.com", ActorID: actorID, Old: nil, New: first},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("History returned %v changes, want %v", len(changes), len(want))
+	}
+	for n, c := range changes {
+		c.Time = want[n].Time
+		if c != want[n] {
+			t.Errorf("History()[%v] = %+v, want %+v", n, c, want[n])
+		}
+	}
+	if last, ok := fixer.LastUndoable(changes); ok {
+		t.Errorf("LastUndoable = %+v after undoing every change, want none", last)
+	}
+}
+
+func testWritesReturnRecordedChanges(t *testing.T, s fixer.Store) {
+	first := fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"}
+	second := fixer.PrependFixer{Prefix: "https://proxy/"}
+
+	// Each write returns exactly the change it recorded, so callers can
+	// announce it without reading the fixer separately.
+	checkRecorded := func(op string, got fixer.Change, want fixer.Change) {
+		t.Helper()
+		changes, err := s.History(guildID, "twitter.com")
+		if err != nil {
+			t.Fatalf("History failed: %v", err)
+		}
+		if len(changes) == 0 {
+			t.Fatalf("%v recorded no change", op)
+		}
+		recorded := changes[0]
+		if !got.Time.Equal(recorded.Time) {
+			t.Errorf("%v returned a change at %v, want the recorded time %v", op, got.Time, recorded.Time)
+		}
+		got.Time, recorded.Time = want.Time, want.Time
+		if got != recorded {
+			t.Errorf("%v returned %+v, want the recorded change %+v", op, got, recorded)
+		}
+		if got != want {
+			t.Errorf("%v returned %+v, want %+v", op, got, want)
+		}
+	}
+
+	c, err := s.Put(guildID, "twitter.com", first, actorID)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	checkRecorded("Put", c, fixer.Change{GuildID: guildID, Domain: "twitter.com", ActorID: actorID, New: first})
+
+	c, err = s.Put(guildID, "twitter.com", second, actorID)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	checkRecorded("Put", c, fixer.Change{GuildID: guildID, Domain: "twitter.com", ActorID: actorID, Old: first, New: second})
+
+	c, ok, err := s.Undo(c, actorID)
+	if err != nil || !ok {
+		t.Fatalf("Undo = %v, %v", ok, err)
+	}
+	checkRecorded("Undo", c, fixer.Change{GuildID: guildID, Domain: "twitter.com", ActorID: actorID, Old: second, New: first, Undo: true})
+
+	c, ok, err = s.Delete(guildID, "twitter.com", actorID)
+	if err != nil || !ok {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+	checkRecorded("Delete", c, fixer.Change{GuildID: guildID, Domain: "twitter.com", ActorID: actorID, Old: first})
+
+	// Nothing is recorded, or returned, when there is nothing to delete.
+	c, ok, err = s.Delete(guildID, "twitter.com", actorID)
+	if err != nil || ok || c != (fixer.Change{}) {
+		t.Errorf("Delete of a missing fixer = %+v, %v, %v, want no change", c, ok, err)
+	}
+	c, ok, err = s.Undo(fixer.Change{GuildID: guildID, Domain: "twitter.com", New: first}, actorID)
+	if err != nil || ok || c != (fixer.Change{}) {
+		t.Errorf("Undo of a deleted fixer's creation = %+v, %v, %v, want no change", c, ok, err)
+	}
+}
+
+func testSettings(t *testing.T, s fixer.Store) {
+	got, err := s.GetSettings(guildID)
+	if err != nil {
+		t.Fatalf("GetSettings on missing guild failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, fixer.GuildSettings{}) {
+		t.Errorf("GetSettings on missing guild = %+v, want zero value", got)
+	}
+
+	want := fixer.GuildSettings{LogChannelID: "555555555", IgnoredUserIDs: []string{actorID}}
+	err = s.PutSettings(guildID, want)
+	if err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+
+	got, err = s.GetSettings(guildID)
+	if err != nil {
+		t.Fatalf("GetSettings failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSettings = %+v, want %+v", got, want)
+	}
+}
+
+func testDeparted(t *testing.T, s fixer.Store) {
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	err := s.MarkDeparted(guildID, at)
+	if err != nil {
+		t.Fatalf("MarkDeparted failed: %v", err)
+	}
+
+	departed, err := s.Departed()
+	if err != nil {
+		t.Fatalf("Departed failed: %v", err)
+	}
+	if len(departed) != 1 || !departed[guildID].Equal(at) {
+		t.Errorf("Departed = %v, want %v departed at %v", departed, guildID, at)
+	}
+
+	err = s.MarkDeparted(guildID, time.Time{})
+	if err != nil {
+		t.Fatalf("MarkDeparted with zero time failed: %v", err)
+	}
+
+	departed, err = s.Departed()
+	if err != nil {
+		t.Fatalf("Departed failed: %v", err)
+	}
+	if len(departed) != 0 {
+		t.Errorf("Departed after clearing mark = %v, want none", departed)
+	}
+}
+
+func testPurge(t *testing.T, s fixer.Store) {
+	mustPut(t, s, guildID, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+	mustPut(t, s, otherGuildID, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+	err := s.PutSettings(guildID, fixer.GuildSettings{LogChannelID: "555555555"})
+	if err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+	err = s.MarkDeparted(guildID, time.Now())
+	if err != nil {
+		t.Fatalf("MarkDeparted failed: %v", err)
+	}
+
+	err = s.Purge(guildID)
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+
+	_, err = s.List(guildID)
+	if !errors.Is(err, fixer.ErrGuildNotFound) {
+		t.Errorf("List after Purge returned %v, want ErrGuildNotFound", err)
+	}
+	changes, err := s.History(guildID, "")
+	if err != nil || len(changes) != 0 {
+		t.Errorf("History after Purge = %v, %v, want no changes", changes, err)
+	}
+	settings, err := s.GetSettings(guildID)
+	if err != nil || !reflect.DeepEqual(settings, fixer.GuildSettings{}) {
+		t.Errorf("GetSettings after Purge = %+v, %v, want zero value", settings, err)
+	}
+	departed, err := s.Departed()
+	if err != nil || len(departed) != 0 {
+		t.Errorf("Departed after Purge = %v, %v, want none", departed, err)
+	}
+
+	_, err = s.Get(otherGuildID, "twitter.com")
+	if err != nil {
+		t.Errorf("Purge affected other guild: %v", err)
+	}
+
+	err = s.Purge(guildID)
+	if err != nil {
+		t.Errorf("Purge on missing guild failed: %v", err)
+	}
+}
+
+func testSizes(t *testing.T, s fixer.Store) {
+	mustPut(t, s, guildID, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+	mustPut(t, s, guildID, "youtube.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+	mustPut(t, s, fixer.GlobalScope, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+	err := s.PutSettings(otherGuildID, fixer.GuildSettings{LogChannelID: "555555555"})
+	if err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+
+	sizes, err := s.Sizes()
+	if err != nil {
+		t.Fatalf("Sizes failed: %v", err)
+	}
+
+	want := map[string]int{guildID: 2, fixer.GlobalScope: 1}
+	if len(sizes) != len(want) {
+		t.Errorf("Sizes = %v, want %v", sizes, want)
+	}
+	for id, n := range want {
+		if sizes[id] != n {
+			t.Errorf("Sizes()[%q] = %v, want %v", id, sizes[id], n)
+		}
+	}
+}
+
+func testGuilds(t *testing.T, s fixer.Store) {
+	// Each guild has a different kind of data, and deleting a fixer leaves
+	// its history behind.
+	mustPut(t, s, fixer.GlobalScope, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+	mustPut(t, s, guildID, "twitter.com", fixer.PrependFixer{Prefix: "https://proxy/"})
+	_, _, err := s.Delete(guildID, "twitter.com", actorID)
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	err = s.PutSettings(otherGuildID, fixer.GuildSettings{LogChannelID: "555555555"})
+	if err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+	err = s.MarkDeparted("222222222", time.Now())
+	if err != nil {
+		t.Fatalf("MarkDeparted failed: %v", err)
+	}
+
+	got, err := s.Guilds()
+	if err != nil {
+		t.Fatalf("Guilds failed: %v", err)
+	}
+	want := []string{fixer.GlobalScope, guildID, "222222222", otherGuildID}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("Guilds = %v, want %v", got, want)
+	}
+
+	err = s.Purge(otherGuildID)
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	got, err = s.Guilds()
+	if err != nil {
+		t.Fatalf("Guilds failed: %v", err)
+	}
+	if slices.Contains(got, otherGuildID) {
+		t.Errorf("Guilds = %v after purging %v", got, otherGuildID)
+	}
+}
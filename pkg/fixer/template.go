@@ -0,0 +1,218 @@
+package fixer
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/charmbracelet/log"
+)
+
+// templateFuncs are the functions available in TemplateFixer templates, in
+// addition to text/template's builtins.
+var templateFuncs = template.FuncMap{
+	"join":       strings.Join,
+	"trimPrefix": strings.TrimPrefix,
+	"trimSuffix": strings.TrimSuffix,
+	"replace":    strings.ReplaceAll,
+}
+
+// validationURL is fixed when a TemplateFixer is created, to catch templates
+// that parse but fail to execute.
+const validationURL = "https://www.example.com/path/to/page?q=query#fragment"
+
+// URLParts are the parts of a link available to TemplateFixer templates.
+type URLParts struct {
+	// URL is the whole link.
+	URL    string
+	Scheme string
+	// Host is the link's host, including any port.
+	Host string
+	// Domain is the last two labels of the host, e.g. "twitter.com" for
+	// "mobile.twitter.com", and Subdomains are the labels before it.
+	Domain     string
+	Subdomains []string
+	// Labels are all of the host's labels.
+	Labels []string
+	// Path is the link's path, starting with a slash, and Segments are its
+	// non-empty segments.
+	Path     string
+	Segments []string
+	// Query holds the link's query values, e.g. {{.Query.Get "v"}}, and
+	// RawQuery is the encoded query without the "?".
+	Query    url.Values
+	RawQuery string
+	Fragment string
+	// Captures are the matches of the TemplateFixer's Pattern, with the
+	// whole match first, and Named are its named capture groups.
+	Captures []string
+	Named    map[string]string
+}
+
+// ParseURLParts splits link into URLParts, with the captures of re if it is
+// not nil.
+func ParseURLParts(link string, re *regexp.Regexp) (URLParts, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return URLParts{}, err
+	}
+
+	parts := URLParts{
+		URL:      link,
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Labels:   strings.Split(u.Hostname(), "."),
+		Path:     u.Path,
+		Query:    u.Query(),
+		RawQuery: u.RawQuery,
+		Fragment: u.Fragment,
+		Named:    map[string]string{},
+	}
+
+	if n := len(parts.Labels); n > 2 {
+		parts.Subdomains = parts.Labels[:n-2]
+		parts.Domain = strings.Join(parts.Labels[n-2:], ".")
+	} else {
+		parts.Domain = u.Hostname()
+	}
+
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment != "" {
+			parts.Segments = append(parts.Segments, segment)
+		}
+	}
+
+	if re != nil {
+		parts.Captures = re.FindStringSubmatch(link)
+		for n, name := range re.SubexpNames() {
+			if name != "" && n < len(parts.Captures) {
+				parts.Named[name] = parts.Captures[n]
+			}
+		}
+	}
+
+	return parts, nil
+}
+
+// A TemplateFixer builds fixed links by executing a text/template over the
+// URLParts of the link, e.g. "https://vxtwitter.com{{.Path}}".
+type TemplateFixer struct {
+	Template string
+	// Pattern is an optional regular expression whose captures are
+	// available to the template. Links it does not match are not fixed.
+	Pattern string
+}
+
+// NewTemplateFixer returns a TemplateFixer, checking that tmpl and pattern
+// are valid and that tmpl can be executed.
+func NewTemplateFixer(tmpl string, pattern string) (TemplateFixer, error) {
+	f := TemplateFixer{Template: tmpl, Pattern: pattern}
+	cf, err := f.compile()
+	if err != nil {
+		return TemplateFixer{}, err
+	}
+
+	// validationURL need not match the pattern, so fill in every capture
+	// for the template to use.
+	parts, err := ParseURLParts(validationURL, nil)
+	if err != nil {
+		return TemplateFixer{}, err
+	}
+	if cf.re != nil {
+		parts.Captures = make([]string, cf.re.NumSubexp()+1)
+		for n, name := range cf.re.SubexpNames() {
+			parts.Captures[n] = "capture"
+			if name != "" {
+				parts.Named[name] = "capture"
+			}
+		}
+	}
+	err = cf.tmpl.Execute(&strings.Builder{}, parts)
+	if err != nil {
+		return TemplateFixer{}, fmt.Errorf("invalid template %q: %w", tmpl, err)
+	}
+
+	return f, nil
+}
+
+// compile parses f's template and pattern.
+func (f TemplateFixer) compile() (compiledTemplateFixer, error) {
+	tmpl, err := template.New("fixer").Funcs(templateFuncs).Option("missingkey=zero").Parse(f.Template)
+	if err != nil {
+		return compiledTemplateFixer{}, fmt.Errorf("invalid template %q: %w", f.Template, err)
+	}
+
+	var re *regexp.Regexp
+	if f.Pattern != "" {
+		re, err = regexp.Compile(f.Pattern)
+		if err != nil {
+			return compiledTemplateFixer{}, fmt.Errorf("invalid regular expression %q: %w", f.Pattern, err)
+		}
+	}
+
+	return compiledTemplateFixer{TemplateFixer: f, tmpl: tmpl, re: re}, nil
+}
+
+// Fix executes f.Template over the parts of link. Links that f.Pattern does
+// not match, or that the template fails on, are returned unchanged.
+func (f TemplateFixer) Fix(link string) string {
+	cf, err := f.compile()
+	if err != nil {
+		log.Error("could not compile template fixer", "err", err)
+		return link
+	}
+	return cf.Fix(link)
+}
+
+// OutputDomains returns the domain of domain's root link after executing the
+// template.
+func (f TemplateFixer) OutputDomains(domain string) []string {
+	return rootOutputDomains(domain, f.Fix)
+}
+
+// UsesQuery reports that template fixers read the query of links, which
+// they are given whatever GuildSettings.KeepQueryParams is. Fixed links only
+// keep the parts of the query the template uses.
+func (f TemplateFixer) UsesQuery() bool {
+	return true
+}
+
+func (f TemplateFixer) String() string {
+	if f.Pattern == "" {
+		return fmt.Sprintf("template '%v'", f.Template)
+	}
+	return fmt.Sprintf("template '%v' matching '%v'", f.Template, f.Pattern)
+}
+
+// A compiledTemplateFixer is a TemplateFixer whose template and pattern have
+// already been parsed. It is never stored, only cached.
+type compiledTemplateFixer struct {
+	TemplateFixer
+	tmpl *template.Template
+	re   *regexp.Regexp
+}
+
+func (f compiledTemplateFixer) OutputDomains(domain string) []string {
+	return rootOutputDomains(domain, f.Fix)
+}
+
+func (f compiledTemplateFixer) Fix(link string) string {
+	if f.re != nil && !f.re.MatchString(link) {
+		return link
+	}
+
+	parts, err := ParseURLParts(link, f.re)
+	if err != nil {
+		return link
+	}
+
+	b := strings.Builder{}
+	err = f.tmpl.Execute(&b, parts)
+	if err != nil {
+		log.Error("could not execute template", "template", f.Template, "link", link, "err", err)
+		return link
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,159 @@
+package fixer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+func TestTemplateFixerFix(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		pattern  string
+		link     string
+		want     string
+	}{
+		{
+			name:     "Path",
+			template: "https://vxtwitter.com{{.Path}}",
+			link:     "https://x.com/user/status/1?s=20",
+			want:     "https://vxtwitter.com/user/status/1",
+		},
+		{
+			name:     "Query",
+			template: `https://yewtu.be/watch?v={{.Query.Get "v"}}`,
+			link:     "https://youtube.com/watch?v=abc123&t=10",
+			want:     "https://yewtu.be/watch?v=abc123",
+		},
+		{
+			name:     "RawQuery",
+			template: "https://example.org{{.Path}}?{{.RawQuery}}",
+			link:     "https://example.com/a?b=c&d=e",
+			want:     "https://example.org/a?b=c&d=e",
+		},
+		{
+			name:     "HostParts",
+			template: `https://{{join .Subdomains "."}}.example.org/{{.Domain}}`,
+			link:     "https://old.www.reddit.com/r/golang",
+			want:     "https://old.www.example.org/reddit.com",
+		},
+		{
+			name:     "Segments",
+			template: `https://example.org/{{index .Segments 1}}`,
+			link:     "https://example.com/r/golang/comments",
+			want:     "https://example.org/golang",
+		},
+		{
+			name:     "Captures",
+			template: `https://example.org/{{index .Captures 1}}/{{.Named.id}}`,
+			pattern:  `/(\w+)/status/(?P<id>\d+)`,
+			link:     "https://x.com/user/status/123",
+			want:     "https://example.org/user/123",
+		},
+		{
+			name:     "PatternDoesNotMatch",
+			template: `https://example.org/{{index .Captures 1}}`,
+			pattern:  `/status/(\d+)`,
+			link:     "https://x.com/user",
+			want:     "https://x.com/user",
+		},
+		{
+			name:     "Funcs",
+			template: `https://example.org{{trimSuffix .Path "/"}}{{replace .Fragment "-" "_"}}`,
+			link:     "https://example.com/a/#b-c",
+			want:     "https://example.org/ab_c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := fixer.NewTemplateFixer(tt.template, tt.pattern)
+			if err != nil {
+				t.Fatalf("NewTemplateFixer(%q, %q) failed: %v", tt.template, tt.pattern, err)
+			}
+			if got := f.Fix(tt.link); got != tt.want {
+				t.Errorf("Fix(%q) = %q, want %q", tt.link, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTemplateFixerValidates(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		pattern  string
+	}{
+		{"Unparseable", "https://example.org{{.Path", ""},
+		{"UnknownField", "https://example.org{{.Paths}}", ""},
+		{"UnknownFunc", "https://example.org{{lower .Path}}", ""},
+		{"CaptureOutOfRange", "https://example.org/{{index .Captures 2}}", `/(\d+)`},
+		{"InvalidPattern", "https://example.org{{.Path}}", `(`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fixer.NewTemplateFixer(tt.template, tt.pattern)
+			if err == nil {
+				t.Errorf("NewTemplateFixer(%q, %q) succeeded, want error", tt.template, tt.pattern)
+			}
+		})
+	}
+
+	_, err := fixer.NewFixer("template", []string{`https://example.org/{{index .Captures 1}}`, `/(\d+)`})
+	if err != nil {
+		t.Errorf("NewFixer rejected a template using a capture its pattern has: %v", err)
+	}
+}
+
+func TestTemplateFixerGetsQueryInPipeline(t *testing.T) {
+	tmpl := `https://yewtu.be/watch?v={{.Query.Get "v"}}`
+	for _, keepQueryParams := range []bool{false, true} {
+		for name, s := range map[string]fixer.Store{
+			"Uncached": fixer.NewMemoryStore(),
+			"Cached":   fixer.NewCachingStore(fixer.NewMemoryStore()),
+		} {
+			f, err := fixer.NewTemplateFixer(tmpl, "")
+			if err != nil {
+				t.Fatalf("NewTemplateFixer failed: %v", err)
+			}
+			_, err = s.Put(guildID, "youtube.com", f, actorID)
+			if err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+
+			settings := fixer.GuildSettings{KeepQueryParams: keepQueryParams}
+			fixes, err := fixer.FixLinks(s, guildID, "watch https://youtube.com/watch?v=abc123", settings)
+			if err != nil {
+				t.Fatalf("FixLinks failed: %v", err)
+			}
+			if len(fixes) != 1 || fixes[0].Fixed != "https://yewtu.be/watch?v=abc123" {
+				t.Errorf("%v store, KeepQueryParams %v: got fixes %+v, want https://yewtu.be/watch?v=abc123", name, keepQueryParams, fixes)
+			}
+		}
+	}
+}
+
+func TestTemplateFixerCSVRoundTrip(t *testing.T) {
+	csv := `template,x.com,"https://vxtwitter.com/{{join .Segments ""/""}}",^https://
+fallback,x.com,template,https://fixupx.com{{.Path}}
+`
+	fixers, err := fixer.ParseCSV(csv)
+	if err != nil {
+		t.Fatalf("ParseCSV failed: %v", err)
+	}
+
+	out, err := fixer.FormatCSV(fixers)
+	if err != nil {
+		t.Fatalf("FormatCSV failed: %v", err)
+	}
+	if strings.TrimSpace(out) != strings.TrimSpace(csv) {
+		t.Errorf("FormatCSV = %q, want %q", out, csv)
+	}
+
+	if got := fixers["x.com"].Fix("https://x.com/a/b"); got != "https://vxtwitter.com/a/b" {
+		t.Errorf("Fix = %q, want https://vxtwitter.com/a/b", got)
+	}
+}
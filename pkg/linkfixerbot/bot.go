@@ -3,6 +3,9 @@ package linkfixerbot
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
 	"github.com/carreter/discord-linkfixer-bot/pkg/linkfixerbot/commands"
@@ -11,80 +14,318 @@ import (
 	"github.com/charmbracelet/log"
 )
 
+// Config holds the bot's optional settings.
+type Config struct {
+	// GuildRetention is how long a guild's data is kept after the bot leaves
+	// it. Data is kept forever if it is zero.
+	GuildRetention time.Duration
+
+	// OperatorIDs are the users, besides the application's owners, allowed
+	// to run operator-only commands.
+	OperatorIDs []string
+
+	// DevGuildID, if set, registers commands only in that guild instead of
+	// globally. Guild commands update instantly, which is useful during
+	// development.
+	DevGuildID string
+
+	// DeleteCommandsOnShutdown deletes the bot's commands when it shuts down.
+	DeleteCommandsOnShutdown bool
+
+	// MessageContent requests the privileged Message Content intent, without
+	// which Discord withholds the content of most guild messages. It must
+	// also be enabled for the bot in the Discord developer portal.
+	MessageContent bool
+
+	// ShortenerDomains are link shortener domains whose links are expanded
+	// to the links they redirect to before looking up fixers.
+	ShortenerDomains []string
+
+	// AttachmentDomains are the CDN domains whose attachment URLs are fixed
+	// along with the links in a message's content and embeds.
+	AttachmentDomains []string
+}
+
 type LinkfixerBot struct {
 	discord            *discordgo.Session
 	commands           map[string]commands.Command
+	interactive        map[string]commands.InteractiveCommand
 	registeredCommands []*discordgo.ApplicationCommand
 	store              fixer.Store
+	operators          *commands.Operators
+	limiter            *rateLimiter
+	recent             *recentFixes
+	pipeline           *fixer.Pipeline
+	config             Config
+
+	// ctx is the context the bot is running in, for work done by handlers,
+	// and stop cancels it.
+	ctx  context.Context
+	stop context.CancelFunc
+
+	// warnedContentWithheld holds the IDs of the guilds a message with
+	// withheld content has been logged for, so the warning is not repeated
+	// for every message.
+	warnedContentWithheld sync.Map
+}
+
+// manageServerPermissions restricts a command to members who can manage the
+// server by default.
+var manageServerPermissions int64 = discordgo.PermissionManageServer
+
+// interactiveCommands keys the InteractiveCommands among cmds and their
+// subcommands by their custom ID prefixes.
+func interactiveCommands(cmds map[string]commands.Command) map[string]commands.InteractiveCommand {
+	res := map[string]commands.InteractiveCommand{}
+	var walk func(cmd commands.Command)
+	walk = func(cmd commands.Command) {
+		if ic, ok := cmd.(commands.InteractiveCommand); ok {
+			res[ic.CustomIDPrefix()] = ic
+		}
+		if g, ok := cmd.(commands.Group); ok {
+			for _, sub := range g.Subcommands {
+				walk(sub)
+			}
+		}
+	}
+	for _, cmd := range cmds {
+		walk(cmd)
+	}
+	return res
+}
+
+// commandMap keys cmds by their top-level command names.
+func commandMap(cmds ...commands.Command) map[string]commands.Command {
+	res := map[string]commands.Command{}
+	for _, cmd := range cmds {
+		res[cmd.ApplicationCommandTemplate().Name] = cmd
+	}
+	return res
 }
 
-func NewLinkfixerBot(authToken string, store fixer.Store) (*LinkfixerBot, error) {
+func NewLinkfixerBot(authToken string, store fixer.Store, config Config) (*LinkfixerBot, error) {
 	discord, err := discordgo.New("Bot " + authToken)
 	if err != nil {
 		return nil, fmt.Errorf("could not create discord session: %v", err)
 	}
 
-	// In this example, we only care about receiving message events.
-	discord.Identify.Intents = discordgo.IntentsGuildMessages
+	// We only care about message events, in guilds and DMs, and guilds
+	// joining or leaving.
+	discord.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentsGuilds
+	if config.MessageContent {
+		discord.Identify.Intents |= discordgo.IntentsMessageContent
+	}
+
+	operators := &commands.Operators{}
+	operators.Add(config.OperatorIDs...)
+
+	pipeline := &fixer.Pipeline{Store: store, Checker: fixer.NewHealthChecker()}
+	if len(config.ShortenerDomains) > 0 {
+		pipeline.Expander = fixer.NewExpander(config.ShortenerDomains)
+	}
+
+	// Handlers and commands are given ctx when they are created, and it is
+	// cancelled when Run's context is.
+	ctx, stop := context.WithCancel(context.Background())
 
 	lb := &LinkfixerBot{
 		discord: discord,
-		commands: map[string]commands.Command{
-			"replace-fixer":        commands.RegisterReplaceFixerCommand{Store: store},
-			"register-csv-fixers":  commands.RegisterCsvFixersCommand{Store: store},
-			"regexp-replace-fixer": commands.RegisterRegexpReplaceFixerCommand{Store: store},
-			"prepend-fixer":        commands.RegisterPrependFixerCommand{Store: store},
-			"list-fixers":          commands.ListFixersCommand{Store: store},
-			"delete-fixer":         commands.DeleteFixerCommand{Store: store},
-		},
-		store: store,
+		commands: commandMap(
+			commands.Group{
+				Name:                     "fixer",
+				Description:              "Manage this server's URL fixers, or your personal ones in DMs",
+				DefaultMemberPermissions: &manageServerPermissions,
+				Contexts:                 &commands.PrivateContexts,
+				IntegrationTypes:         &commands.AllIntegrationTypes,
+				Subcommands: []commands.Command{
+					commands.Group{
+						Name:        "add",
+						Description: "Register a URL fixer for a domain",
+						Subcommands: []commands.Command{
+							commands.RegisterReplaceFixerCommand{Store: store},
+							commands.RegisterRegexpReplaceFixerCommand{Store: store},
+							commands.RegisterPrependFixerCommand{Store: store},
+							commands.RegisterTemplateFixerCommand{Store: store},
+						},
+					},
+					commands.CreateFixerCommand{Store: store, Drafts: &commands.FixerDrafts{}},
+					commands.Group{
+						Name:        "mirror",
+						Description: "Manage fixers that point links at one of several frontend instances",
+						Subcommands: []commands.Command{
+							commands.RegisterMirrorFixerCommand{Store: store},
+							commands.AddMirrorInstanceCommand{Store: store},
+							commands.RemoveMirrorInstanceCommand{Store: store},
+							commands.SetMirrorStrategyCommand{Store: store},
+						},
+					},
+					commands.Group{
+						Name:        "fallback",
+						Description: "Manage fixers to fall back to when fixed links are down",
+						Subcommands: []commands.Command{
+							commands.AddFallbackFixerCommand{Store: store},
+							commands.ClearFallbackFixersCommand{Store: store},
+						},
+					},
+					commands.ListFixersCommand{Store: store},
+					commands.DeleteFixerCommand{Store: store},
+					commands.RegisterCsvFixersCommand{Store: store},
+					commands.ExportFixersCommand{Store: store},
+					commands.TestFixerCommand{Store: store},
+					commands.FixerHistoryCommand{Store: store},
+					commands.UndoFixerChangeCommand{Store: store},
+				},
+			},
+			commands.Group{
+				Name:                     "linkfixer",
+				Description:              "Configure the bot",
+				DefaultMemberPermissions: &manageServerPermissions,
+				Contexts:                 &commands.GuildContexts,
+				Subcommands: []commands.Command{
+					commands.Group{
+						Name:        "settings",
+						Description: "View and change this server's settings",
+						Subcommands: []commands.Command{
+							commands.ViewSettingsCommand{Store: store},
+							commands.SetSettingCommand{Store: store},
+							commands.ResetSettingsCommand{Store: store},
+						},
+					},
+					commands.GuildSizesCommand{Store: store, Operators: operators},
+				},
+			},
+			commands.FixLinksCommand{Store: store, Pipeline: pipeline, AttachmentDomains: config.AttachmentDomains, Context: ctx},
+		),
+		store:     store,
+		operators: operators,
+		limiter:   newRateLimiter(),
+		recent:    newRecentFixes(),
+		pipeline:  pipeline,
+		config:    config,
+		ctx:       ctx,
+		stop:      stop,
 	}
 
+	lb.interactive = interactiveCommands(lb.commands)
+
 	lb.discord.AddHandler(lb.messageHandler)
+	lb.discord.AddHandler(lb.messageUpdateHandler)
 	lb.discord.AddHandler(lb.interactionHandler)
+	lb.discord.AddHandler(lb.readyHandler)
+	lb.discord.AddHandler(lb.guildCreateHandler)
+	lb.discord.AddHandler(lb.guildDeleteHandler)
+	lb.discord.AddHandler(lb.threadCreateHandler)
 
 	return lb, nil
 
 }
 
 func (lb *LinkfixerBot) interactionHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	if i.Type != discordgo.InteractionApplicationCommand {
+	var response *discordgo.InteractionResponse
+	var err error
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		response, err = lb.handleCommand(s, i)
+	case discordgo.InteractionModalSubmit:
+		response, err = lb.handleFollowUp(s, i, i.ModalSubmitData().CustomID)
+	case discordgo.InteractionMessageComponent:
+		response, err = lb.handleFollowUp(s, i, i.MessageComponentData().CustomID)
+	default:
 		log.Warn("received interaction of unsupported type", "ID", i.ID, "type", i.Type)
 		return
 	}
+	if err != nil {
+		log.Error("could not handle interaction", "interactionID", i.ID, "type", i.Type, "err", err)
+		response = &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: ":sob: Internal server error when running command",
+			},
+		}
+	}
+	if response == nil {
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, response)
+	if err != nil {
+		log.Error("could not respond to interaction", "interactionID", i.ID, "err", err)
+	}
+}
 
+// handleCommand runs the application command in i. It returns a nil response
+// if there is nothing to respond with.
+func (lb *LinkfixerBot) handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
 	data := i.ApplicationCommandData()
 
 	cmd, ok := lb.commands[data.Name]
 	if !ok {
 		log.Warn("received command with no registered handler", "interactionID", i.ID, "commandName", data.Name)
+		return nil, nil
 	}
 
-	options := parseOptions(data.Options)
-	response, err := cmd.Run(i, options)
+	cmd, options, err := parseOptions(cmd, data.Options)
 	if err != nil {
-		log.Error("could not run command", "commandName", data.Name, "options", options, "err", err)
-		response = ":sob: Internal server error when running command"
+		log.Warn("could not route command", "interactionID", i.ID, "commandName", data.Name, "err", err)
+		return nil, nil
 	}
 
-	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	if rc, ok := cmd.(commands.RichCommand); ok {
+		response, err := rc.Respond(s, i, options)
+		if err != nil {
+			return nil, fmt.Errorf("could not run command %v with options %v: %w", data.Name, options, err)
+		}
+		return response, nil
+	}
+
+	content, err := cmd.Run(s, i, options)
+	if err != nil {
+		return nil, fmt.Errorf("could not run command %v with options %v: %w", data.Name, options, err)
+	}
+	return &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: response,
+			Content: content,
 		},
-	})
-	if err != nil {
-		log.Error("could not respond to command", "interactionID", i.ID, "err", err)
+	}, nil
+}
+
+// handleFollowUp routes a modal submission or message component interaction
+// to the command that created it, based on the prefix of its custom ID.
+func (lb *LinkfixerBot) handleFollowUp(s *discordgo.Session, i *discordgo.InteractionCreate, customID string) (*discordgo.InteractionResponse, error) {
+	prefix, _, _ := strings.Cut(customID, ":")
+	cmd, ok := lb.interactive[prefix]
+	if !ok {
+		log.Warn("received interaction with no registered handler", "interactionID", i.ID, "customID", customID)
+		return nil, nil
 	}
+
+	return cmd.HandleInteraction(s, i)
 }
 
-func parseOptions(opts []*discordgo.ApplicationCommandInteractionDataOption) map[string]any {
+// parseOptions walks down the subcommand groups and subcommands in opts,
+// starting from cmd, and returns the command to run along with its options.
+func parseOptions(cmd commands.Command, opts []*discordgo.ApplicationCommandInteractionDataOption) (commands.Command, map[string]any, error) {
 	res := map[string]any{}
 	for _, opt := range opts {
-		res[opt.Name] = opt.Value
+		switch opt.Type {
+		case discordgo.ApplicationCommandOptionSubCommand, discordgo.ApplicationCommandOptionSubCommandGroup:
+			router, ok := cmd.(commands.Router)
+			if !ok {
+				return nil, nil, fmt.Errorf("command has no subcommand %v", opt.Name)
+			}
+
+			sub, ok := router.Subcommand(opt.Name)
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown subcommand %v", opt.Name)
+			}
+			return parseOptions(sub, opt.Options)
+		default:
+			res[opt.Name] = opt.Value
+		}
 	}
 
-	return res
+	return cmd, res, nil
 }
 
 func (lb *LinkfixerBot) messageHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
@@ -93,33 +334,204 @@ func (lb *LinkfixerBot) messageHandler(s *discordgo.Session, m *discordgo.Messag
 		return
 	}
 
-	mUrls := fixer.ExtractURLs(m.Content)
-
-	for _, mUrl := range mUrls {
-		domain := fixer.ExtractDomain(mUrl)
-		f, err := lb.store.Get(m.GuildID, domain)
-		if err != nil {
-			log.Error("could not get domain from store", "domain", domain, "err", err)
-			return
+	if contentWithheld(m.Message) {
+		if _, warned := lb.warnedContentWithheld.LoadOrStore(m.GuildID, true); !warned {
+			log.Warn("received a message without content, so its links cannot be fixed. Enable the Message Content intent for the bot and run with -message-content", "guildID", m.GuildID, "messageID", m.ID)
 		}
+		return
+	}
 
-		if f == nil {
-			log.Debug("no fixer found for domain", "domain", domain)
-			return
+	info, ok := messageChannel(s, m.Message)
+	if !ok {
+		return
+	}
+
+	// Forum posts are fixed by threadCreateHandler instead, as their starter
+	// message can arrive before the thread does.
+	if info.IsForumPost() && m.ID == m.ChannelID {
+		return
+	}
+
+	lb.fixMessage(s, m.Message, info)
+}
+
+// messageUpdateHandler fixes the links in embeds Discord adds to a message
+// after it is sent, such as those of integrations that post links as embeds
+// alone. Edits are ignored, as are messages with links in their content,
+// whose embeds preview links that were fixed when the message was sent.
+func (lb *LinkfixerBot) messageUpdateHandler(s *discordgo.Session, m *discordgo.MessageUpdate) {
+	// Updates to messages that are not in the state only have the fields
+	// that changed, so they cannot be checked against the ignore rules.
+	if m.Author == nil || m.Author.ID == s.State.User.ID {
+		return
+	}
+	if m.EditedTimestamp != nil || len(m.Embeds) == 0 || len(fixer.ExtractURLs(m.Content)) > 0 {
+		return
+	}
+
+	info, ok := messageChannel(s, m.Message)
+	if !ok {
+		return
+	}
+
+	// Only the embeds can have changed, and the duplicate window stops
+	// links in embeds the message was sent with being fixed again.
+	embeds := *m.Message
+	embeds.Attachments = nil
+	lb.fixMessage(s, &embeds, info)
+}
+
+// messageChannel describes the channel of m, if it is in a guild, and
+// reports whether links may be fixed in it.
+func messageChannel(s *discordgo.Session, m *discordgo.Message) (channelInfo, bool) {
+	if m.GuildID == "" {
+		return channelInfo{}, true
+	}
+
+	info, err := resolveChannel(s, m.ChannelID)
+	if err != nil {
+		log.Error("could not resolve channel", "channelID", m.ChannelID, "err", err)
+		return channelInfo{}, false
+	}
+	return info, !info.IsLocked()
+}
+
+// fixMessage posts fixed copies of the links in m in m's channel, which info
+// describes for messages in guilds.
+func (lb *LinkfixerBot) fixMessage(s *discordgo.Session, m *discordgo.Message, info channelInfo) {
+	text := commands.MessageText(m, lb.config.AttachmentDomains)
+	if len(fixer.ExtractURLs(text)) == 0 {
+		return
+	}
+
+	scope := messageScope(m)
+	settings, err := lb.store.GetSettings(scope)
+	if err != nil {
+		log.Error("could not get settings", "scope", scope, "err", err)
+		return
+	}
+
+	if reason := ignoreReason(m, settings); reason != "" {
+		log.Debug("ignoring message", "scope", scope, "messageID", m.ID, "reason", reason)
+		return
+	}
+
+	fixes, err := lb.pipeline.FixLinks(lb.ctx, scope, text, settings)
+	if err != nil {
+		log.Error("could not fix links", "scope", scope, "messageID", m.ID, "err", err)
+		return
+	}
+
+	// Each thread is its own conversation, so links are only reposts within
+	// it, but threads share their parent's rate limits.
+	fixes = lb.skipDuplicates(m, m.ChannelID, settings, fixes)
+	limitChannelID := info.LimitChannelID(m.ChannelID)
+
+	for _, group := range lb.limitFixes(m, scope, limitChannelID, settings, fixes) {
+		var links []string
+		for _, fix := range group {
+			links = append(links, fix.Fixed)
 		}
 
-		mUrl = fixer.RemoveQueryParams(mUrl)
-		_, err = s.ChannelMessageSendReply(m.ChannelID, f.Fix(mUrl), m.Reference())
+		_, err = s.ChannelMessageSendComplex(m.ChannelID, fixedLinkMessage(m, settings, strings.Join(links, "\n")))
 		if err != nil {
 			log.Error("sending fixed link failed", "channelID", m.ChannelID, "messageID", m.ID)
 			return
 		}
+
+		if window := settings.EffectiveDuplicateWindow(); window > 0 {
+			lb.recent.add(m.ChannelID, window, links...)
+		}
+	}
+}
+
+// skipDuplicates removes the fixes whose fixed links were recently posted in
+// the channel, or that repeat another fix in m.
+func (lb *LinkfixerBot) skipDuplicates(m *discordgo.Message, channelID string, settings fixer.GuildSettings, fixes []fixer.Fix) []fixer.Fix {
+	checkRecent := settings.EffectiveDuplicateWindow() > 0
+
+	var res []fixer.Fix
+	seen := map[string]bool{}
+	for _, fix := range fixes {
+		if seen[fix.Fixed] {
+			continue
+		}
+		seen[fix.Fixed] = true
+
+		if checkRecent && lb.recent.seen(channelID, fix.Fixed) {
+			log.Debug("skipping recently fixed link", "channelID", channelID, "messageID", m.ID, "link", fix.Fixed)
+			continue
+		}
+		res = append(res, fix)
+	}
+	return res
+}
+
+// limitFixes applies the rate limits for m's author, the channel and guild to
+// fixes, and returns the fixes to post in each message.
+func (lb *LinkfixerBot) limitFixes(m *discordgo.Message, scope string, channelID string, settings fixer.GuildSettings, fixes []fixer.Fix) [][]fixer.Fix {
+	allowed := lb.limiter.take(len(fixes),
+		rateLimit{key: "user:" + scope + ":" + m.Author.ID, perMinute: settings.EffectiveUserFixesPerMinute()},
+		rateLimit{key: "channel:" + channelID, perMinute: settings.EffectiveChannelFixesPerMinute()},
+		rateLimit{key: "guild:" + scope, perMinute: settings.EffectiveGuildFixesPerMinute()},
+	)
+
+	var groups [][]fixer.Fix
+	for _, fix := range fixes {
+		groups = append(groups, []fixer.Fix{fix})
+	}
+	if allowed == len(fixes) {
+		return groups
+	}
+
+	action := settings.EffectiveRateLimitAction()
+	log.Info("rate limiting fixed links", "scope", scope, "channelID", channelID, "userID", m.Author.ID, "messageID", m.ID, "numFixes", len(fixes), "numAllowed", allowed, "action", action)
+
+	if allowed == 0 {
+		return nil
+	}
+	if action == fixer.RateLimitCoalesce {
+		return append(groups[:allowed-1], fixes[allowed-1:])
+	}
+	return groups[:allowed]
+}
+
+// messageScope returns the guild ID fixers are looked up under for m: the
+// guild it was posted in, or its author's personal scope in DMs.
+func messageScope(m *discordgo.Message) string {
+	if m.GuildID != "" {
+		return m.GuildID
+	}
+	return fixer.UserScope(m.Author.ID)
+}
+
+// fixedLinkMessage builds the message posting content, one or more fixed
+// links, in response to m.
+func fixedLinkMessage(m *discordgo.Message, settings fixer.GuildSettings, content string) *discordgo.MessageSend {
+	msg := &discordgo.MessageSend{
+		Content: content,
+	}
+
+	if settings.EffectiveReplyMode() == fixer.ReplyModeReply {
+		msg.Reference = m.Reference()
+		msg.AllowedMentions = &discordgo.MessageAllowedMentions{
+			RepliedUser: !settings.SuppressMentions,
+		}
 	}
+
+	return msg
 }
 
 func (lb *LinkfixerBot) Run(ctx context.Context) error {
+	context.AfterFunc(ctx, lb.stop)
+
+	err := lb.checkMessageContentIntent()
+	if err != nil {
+		log.Error("could not check for the Message Content intent", "err", err)
+	}
+
 	log.Info("opening connection to discord...")
-	err := lb.discord.Open()
+	err = lb.discord.Open()
 	if err != nil {
 		fmt.Printf("error opening connection: %v\n", err)
 		return err
@@ -132,38 +544,24 @@ func (lb *LinkfixerBot) Run(ctx context.Context) error {
 		return fmt.Errorf("could not create commands: %w", err)
 	}
 
-	log.Info("bot ready")
-
-	<-ctx.Done()
-
-	log.Info("shutting down")
-	err = lb.deleteCommands()
+	err = lb.addApplicationOwners()
 	if err != nil {
-		log.Error("could not delete commands on shutdown", "err", err)
-		return err
+		log.Error("could not get application owners", "err", err)
 	}
-	return nil
-}
 
-func (lb *LinkfixerBot) registerCommands() error {
-	var commandTemplates []*discordgo.ApplicationCommand
-	for _, command := range lb.commands {
-		commandTemplates = append(commandTemplates, command.ApplicationCommandTemplate())
-	}
-	registeredCommands, err := lb.discord.ApplicationCommandBulkOverwrite(lb.discord.State.Application.ID, "", commandTemplates)
-	if err != nil {
-		return err
+	if lb.config.GuildRetention > 0 {
+		go lb.purgeDepartedGuilds(ctx)
 	}
 
-	log.Info("successfully registered commands", "numRegistered", len(registeredCommands))
-	lb.registeredCommands = registeredCommands
-	return nil
-}
+	log.Info("bot ready")
+
+	<-ctx.Done()
 
-func (lb *LinkfixerBot) deleteCommands() error {
-	for _, command := range lb.registeredCommands {
-		err := lb.discord.ApplicationCommandDelete(lb.discord.State.Application.ID, "", command.ID)
+	log.Info("shutting down")
+	if lb.config.DeleteCommandsOnShutdown {
+		err = lb.deleteCommands()
 		if err != nil {
+			log.Error("could not delete commands on shutdown", "err", err)
 			return err
 		}
 	}
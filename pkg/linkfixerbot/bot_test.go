@@ -0,0 +1,63 @@
+package linkfixerbot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+func TestMessageUpdateFixesAddedEmbeds(t *testing.T) {
+	fd := &fakeDiscord{}
+	lb := newTestBot(t, fd, fixer.GuildSettings{})
+
+	var mu discordgo.MessageUpdate
+	loadEvent(t, "message_update_embed", &mu)
+	lb.messageUpdateHandler(lb.discord, &mu)
+
+	want := []sentMessage{{ChannelID: testChannelID, Content: testTwitterFix}}
+	if got := fd.Sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+
+	// Discord can send several updates as it fills in an embed, which do
+	// not fix it again.
+	lb.messageUpdateHandler(lb.discord, &mu)
+	if got := fd.Sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v after a second update, want %v", got, want)
+	}
+}
+
+func TestMessageUpdateIgnored(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(m *discordgo.Message)
+	}{
+		// The links in the content were fixed when the message was sent.
+		{"LinkInContent", func(m *discordgo.Message) { m.Content = "look https://twitter.com/golang/status/1" }},
+		{"Edited", func(m *discordgo.Message) {
+			edited := time.Date(2026, 10, 19, 12, 1, 0, 0, time.UTC)
+			m.EditedTimestamp = &edited
+		}},
+		{"Partial", func(m *discordgo.Message) { m.Author = nil }},
+		{"OwnMessage", func(m *discordgo.Message) { m.Author = &discordgo.User{ID: testBotID} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd := &fakeDiscord{}
+			lb := newTestBot(t, fd, fixer.GuildSettings{})
+
+			var mu discordgo.MessageUpdate
+			loadEvent(t, "message_update_embed", &mu)
+			tt.update(mu.Message)
+			lb.messageUpdateHandler(lb.discord, &mu)
+
+			if got := fd.Sent(); len(got) != 0 {
+				t.Errorf("sent %v, want nothing", got)
+			}
+		})
+	}
+}
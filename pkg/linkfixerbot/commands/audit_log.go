@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+	"github.com/charmbracelet/log"
+)
+
+// maxEmbedFields is the maximum number of fields Discord accepts in an embed.
+const maxEmbedFields = 25
+
+// putFixer stores f for domain in the interaction's scope, and returns the
+// change the store recorded for announceChanges.
+func putFixer(store fixer.Store, i *discordgo.InteractionCreate, domain string, f fixer.Fixer) (fixer.Change, error) {
+	return store.Put(scopeID(i), domain, f, interactionUserID(i))
+}
+
+// deleteFixer deletes the fixer for domain in the interaction's scope, and
+// returns the change the store recorded for announceChanges. It reports
+// false if there was no fixer to delete.
+func deleteFixer(store fixer.Store, i *discordgo.InteractionCreate, domain string) (fixer.Change, bool, error) {
+	return store.Delete(scopeID(i), domain, interactionUserID(i))
+}
+
+// undoChange reverts c in the interaction's scope, and returns the change the
+// store recorded for announceChanges. It reports false if there was nothing
+// to undo.
+func undoChange(store fixer.Store, i *discordgo.InteractionCreate, c fixer.Change) (fixer.Change, bool, error) {
+	return store.Undo(c, interactionUserID(i))
+}
+
+// announceChanges posts an embed describing changes to the guild's log
+// channel, if one is configured.
+//
+// Failures are logged rather than returned, as the changes themselves have
+// already been made.
+func announceChanges(s *discordgo.Session, store fixer.Store, i *discordgo.InteractionCreate, changes ...fixer.Change) {
+	settings, err := store.GetSettings(scopeID(i))
+	if err != nil {
+		log.Error("could not get settings", "scope", scopeID(i), "err", err)
+		return
+	}
+
+	if settings.LogChannelID == "" || len(changes) == 0 {
+		return
+	}
+
+	var fields []*discordgo.MessageEmbedField
+	for n, change := range changes {
+		if len(fields) == maxEmbedFields-1 && len(changes) > maxEmbedFields {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  "…",
+				Value: fmt.Sprintf("and %v more changes", len(changes)-n),
+			})
+			break
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  change.Domain,
+			Value: changeDiff(change),
+		})
+	}
+
+	_, err = s.ChannelMessageSendEmbed(settings.LogChannelID, &discordgo.MessageEmbed{
+		Title:       "Fixer configuration changed",
+		Description: fmt.Sprintf("<@%v> used `/%v`", interactionUserID(i), commandPath(i)),
+		Fields:      fields,
+		Timestamp:   time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Error("could not post to log channel", "scope", scopeID(i), "channelID", settings.LogChannelID, "err", err)
+	}
+}
+
+// checkLogChannel returns why channelID cannot be the guild's log channel, or
+// "" if it can.
+func checkLogChannel(s *discordgo.Session, guildID string, channelID string) (string, error) {
+	channel, err := s.State.Channel(channelID)
+	if err != nil {
+		channel, err = s.Channel(channelID)
+	}
+
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil &&
+		(restErr.Response.StatusCode == http.StatusNotFound || restErr.Response.StatusCode == http.StatusForbidden) {
+		return fmt.Sprintf("the bot cannot see channel <#%v>", channelID), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not get channel %v: %w", channelID, err)
+	}
+
+	if channel.GuildID != guildID {
+		return fmt.Sprintf("channel <#%v> is not in this server", channelID), nil
+	}
+	return "", nil
+}
+
+// changeDiff formats a change as a diff code block.
+func changeDiff(c fixer.Change) string {
+	diff := "```diff\n"
+	if c.Old != nil {
+		diff += fmt.Sprintf("- %v\n", c.Old)
+	}
+	if c.New != nil {
+		diff += fmt.Sprintf("+ %v\n", c.New)
+	}
+	return diff + "```"
+}
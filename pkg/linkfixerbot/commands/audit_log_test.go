@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+const (
+	testGuildID = "800000000000000001"
+	testUserID  = "800000000000000050"
+)
+
+// testInteraction returns a slash command interaction from a member of the
+// test guild, which the bot is installed in.
+func testInteraction() *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:    discordgo.InteractionApplicationCommand,
+		GuildID: testGuildID,
+		Member:  &discordgo.Member{User: &discordgo.User{ID: testUserID}},
+		AuthorizingIntegrationOwners: map[discordgo.ApplicationIntegrationType]string{
+			discordgo.ApplicationIntegrationGuildInstall: testGuildID,
+		},
+	}}
+}
+
+func TestPutAndDeleteFixerReturnChanges(t *testing.T) {
+	store := fixer.NewMemoryStore()
+	i := testInteraction()
+	first := fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"}
+	second := fixer.ReplaceFixer{Old: "twitter.com", New: "fxtwitter.com"}
+
+	change, err := putFixer(store, i, "twitter.com", first)
+	if err != nil {
+		t.Fatalf("putFixer failed: %v", err)
+	}
+	if change.Old != nil || change.New != first || change.ActorID != testUserID {
+		t.Errorf("putFixer of a new fixer = %+v, want a change from nil to %v by %v", change, first, testUserID)
+	}
+
+	change, err = putFixer(store, i, "twitter.com", second)
+	if err != nil {
+		t.Fatalf("putFixer failed: %v", err)
+	}
+	if change.Old != first || change.New != second {
+		t.Errorf("putFixer of a changed fixer = %+v, want a change from %v to %v", change, first, second)
+	}
+
+	change, deleted, err := deleteFixer(store, i, "twitter.com")
+	if err != nil {
+		t.Fatalf("deleteFixer failed: %v", err)
+	}
+	if !deleted || change.Old != second || change.New != nil {
+		t.Errorf("deleteFixer = %+v, %v, want a change from %v to nil", change, deleted, second)
+	}
+
+	_, deleted, err = deleteFixer(store, i, "twitter.com")
+	if err != nil {
+		t.Fatalf("deleteFixer failed: %v", err)
+	}
+	if deleted {
+		t.Errorf("deleteFixer of a missing fixer reported a deletion")
+	}
+}
+
+// roundTripFunc is an http.RoundTripper that calls itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCheckLogChannel(t *testing.T) {
+	s, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatalf("could not create session: %v", err)
+	}
+	// Channels not in the state are unknown to the API.
+	s.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Status:     "404 Not Found",
+			Body:       io.NopCloser(strings.NewReader(`{"message": "Unknown Channel", "code": 10003}`)),
+			Header:     http.Header{},
+			Request:    req,
+		}, nil
+	})}
+
+	for _, g := range []*discordgo.Guild{
+		{ID: testGuildID, Channels: []*discordgo.Channel{{ID: "800000000000000010", GuildID: testGuildID, Type: discordgo.ChannelTypeGuildText}}},
+		{ID: "800000000000000002", Channels: []*discordgo.Channel{{ID: "800000000000000030", GuildID: "800000000000000002", Type: discordgo.ChannelTypeGuildText}}},
+	} {
+		err = s.State.GuildAdd(g)
+		if err != nil {
+			t.Fatalf("could not add guild to state: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		channelID string
+		ok        bool
+	}{
+		{"InGuild", "800000000000000010", true},
+		{"OtherGuild", "800000000000000030", false},
+		{"Unknown", "800000000000000040", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem, err := checkLogChannel(s, testGuildID, tt.channelID)
+			if err != nil {
+				t.Fatalf("checkLogChannel failed: %v", err)
+			}
+			if ok := problem == ""; ok != tt.ok {
+				t.Errorf("checkLogChannel(%v) = %q, want ok = %v", tt.channelID, problem, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// draftTTL is how long a fixer draft is kept. It matches the lifetime of an
+// interaction token, after which the preview message can no longer be
+// updated anyway.
+const draftTTL = 15 * time.Minute
+
+// A fixerDraft holds the fields entered into the create fixer modal.
+type fixerDraft struct {
+	Scope     string
+	Domain    string
+	Type      string
+	Params    string
+	SampleURL string
+	Created   time.Time
+}
+
+// build validates the draft and returns the fixer and domain it describes.
+func (d fixerDraft) build() (fixer.Fixer, string, error) {
+	domain := fixer.ExtractDomain(d.Domain)
+	if domain == "" {
+		return nil, "", fmt.Errorf("invalid domain %q", d.Domain)
+	}
+
+	// Parameters are entered one per line, so they can contain commas and
+	// backslashes without any quoting. Blank lines at either end, such as
+	// after a trailing newline, are not parameters, but blank lines between
+	// parameters are kept as empty ones.
+	params := strings.Split(strings.ReplaceAll(d.Params, "\r\n", "\n"), "\n")
+	for len(params) > 0 && strings.TrimSpace(params[len(params)-1]) == "" {
+		params = params[:len(params)-1]
+	}
+	for len(params) > 0 && strings.TrimSpace(params[0]) == "" {
+		params = params[1:]
+	}
+	f, err := fixer.NewFixer(strings.ToLower(strings.TrimSpace(d.Type)), params)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, domain, nil
+}
+
+// FixerDrafts holds fixers being created with CreateFixerCommand until they
+// are saved, cancelled or expire.
+type FixerDrafts struct {
+	mu     sync.Mutex
+	drafts map[string]fixerDraft
+}
+
+func (fd *FixerDrafts) get(id string) (fixerDraft, bool) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+
+	d, ok := fd.drafts[id]
+	if !ok || time.Since(d.Created) > draftTTL {
+		return fixerDraft{}, false
+	}
+	return d, true
+}
+
+func (fd *FixerDrafts) put(id string, d fixerDraft) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+
+	if fd.drafts == nil {
+		fd.drafts = map[string]fixerDraft{}
+	}
+	for other, od := range fd.drafts {
+		if time.Since(od.Created) > draftTTL {
+			delete(fd.drafts, other)
+		}
+	}
+	fd.drafts[id] = d
+}
+
+func (fd *FixerDrafts) delete(id string) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	delete(fd.drafts, id)
+}
+
+// CreateFixerCommand registers a fixer through a modal, which is easier to
+// type regular expressions into than slash command options. The fixer is
+// previewed on a sample URL and only saved once the user confirms it.
+type CreateFixerCommand struct {
+	Store  fixer.Store
+	Drafts *FixerDrafts
+}
+
+// Custom ID parts used by CreateFixerCommand, following its prefix.
+const (
+	createFixerModal  = "modal"
+	createFixerSave   = "save"
+	createFixerEdit   = "edit"
+	createFixerCancel = "cancel"
+)
+
+// Custom IDs of the text inputs in the create fixer modal.
+const (
+	createFixerDomainInput = "domain"
+	createFixerTypeInput   = "type"
+	createFixerParamsInput = "params"
+	createFixerSampleInput = "sample"
+)
+
+func (c CreateFixerCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "create",
+		Description: "Register a URL fixer using a form, with a preview before saving",
+	}
+}
+
+func (c CreateFixerCommand) CustomIDPrefix() string {
+	return "create-fixer"
+}
+
+func (c CreateFixerCommand) customID(action string, draftID string) string {
+	return fmt.Sprintf("%v:%v:%v", c.CustomIDPrefix(), action, draftID)
+}
+
+func (c CreateFixerCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	return "", fmt.Errorf("create fixer must be run with Respond")
+}
+
+func (c CreateFixerCommand) Respond(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (*discordgo.InteractionResponse, error) {
+	return c.modal(i.ID, fixerDraft{}), nil
+}
+
+// modal returns the create fixer modal, filled in with d.
+func (c CreateFixerCommand) modal(draftID string, d fixerDraft) *discordgo.InteractionResponse {
+	input := func(customID, label, placeholder, value string, style discordgo.TextInputStyle, required bool) discordgo.MessageComponent {
+		return discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.TextInput{
+					CustomID:    customID,
+					Label:       label,
+					Style:       style,
+					Placeholder: placeholder,
+					Value:       value,
+					Required:    required,
+				},
+			},
+		}
+	}
+
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: c.customID(createFixerModal, draftID),
+			Title:    "Create a URL fixer",
+			Components: []discordgo.MessageComponent{
+				input(createFixerDomainInput, "Domain", "x.com", d.Domain, discordgo.TextInputShort, true),
+				input(createFixerTypeInput, "Type", strings.Join(fixer.FixerTypes, ", "), d.Type, discordgo.TextInputShort, true),
+				input(createFixerParamsInput, "Parameters, one per line", "e.g. for regex:\n(www\\.)?reddit\\.com\nold.reddit.com", d.Params, discordgo.TextInputParagraph, true),
+				input(createFixerSampleInput, "Sample URL to preview", "https://x.com/user/status/123", d.SampleURL, discordgo.TextInputShort, false),
+			},
+		},
+	}
+}
+
+func (c CreateFixerCommand) HandleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error) {
+	var customID string
+	switch i.Type {
+	case discordgo.InteractionModalSubmit:
+		customID = i.ModalSubmitData().CustomID
+	case discordgo.InteractionMessageComponent:
+		customID = i.MessageComponentData().CustomID
+	}
+
+	parts := strings.SplitN(customID, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid custom ID %q", customID)
+	}
+	action, draftID := parts[1], parts[2]
+
+	if action == createFixerModal {
+		return c.preview(i, draftID)
+	}
+
+	d, ok := c.Drafts.get(draftID)
+	if !ok || d.Scope != scopeID(i) {
+		return updateResponse("This fixer draft has expired, use `/fixer create` to start again.", nil), nil
+	}
+
+	switch action {
+	case createFixerEdit:
+		return c.modal(draftID, d), nil
+	case createFixerCancel:
+		c.Drafts.delete(draftID)
+		return updateResponse("Cancelled creating fixer.", nil), nil
+	case createFixerSave:
+		f, domain, err := d.build()
+		if err != nil {
+			return updateResponse(fmt.Sprintf("Could not create fixer: %v", err), nil), nil
+		}
+
+		change, err := putFixer(c.Store, i, domain, f)
+		if err != nil {
+			return nil, fmt.Errorf("storing fixer failed: %w", err)
+		}
+		c.Drafts.delete(draftID)
+		announceChanges(s, c.Store, i, change)
+
+		return updateResponse(fmt.Sprintf("Successfully registered fixer `%v` for domain `%v`", f.String(), domain), nil), nil
+	default:
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+}
+
+// preview stores the draft submitted in the modal and shows what the fixer
+// would do, with buttons to save it, edit it or cancel.
+func (c CreateFixerCommand) preview(i *discordgo.InteractionCreate, draftID string) (*discordgo.InteractionResponse, error) {
+	d := fixerDraft{
+		Scope:   scopeID(i),
+		Created: time.Now(),
+	}
+	for _, row := range i.ModalSubmitData().Components {
+		ar, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, component := range ar.Components {
+			ti, ok := component.(*discordgo.TextInput)
+			if !ok {
+				continue
+			}
+			switch ti.CustomID {
+			case createFixerDomainInput:
+				d.Domain = strings.TrimSpace(ti.Value)
+			case createFixerTypeInput:
+				d.Type = strings.TrimSpace(ti.Value)
+			case createFixerParamsInput:
+				d.Params = ti.Value
+			case createFixerSampleInput:
+				d.SampleURL = strings.TrimSpace(ti.Value)
+			}
+		}
+	}
+	c.Drafts.put(draftID, d)
+
+	var content string
+	f, domain, err := d.build()
+	if err != nil {
+		content = fmt.Sprintf("Could not create fixer: %v", err)
+	} else {
+		content = fmt.Sprintf("Fixer `%v` for domain `%v`", f.String(), domain)
+
+		if d.SampleURL != "" {
+			settings, err := c.Store.GetSettings(scopeID(i))
+			if err != nil {
+				return nil, fmt.Errorf("could not get settings: %w", err)
+			}
+
+			content += fmt.Sprintf(" turns\n`%v`\ninto\n`%v`", d.SampleURL, fixer.ApplyFixer(f, d.SampleURL, settings))
+
+			if sampleDomain := fixer.ExtractDomain(d.SampleURL); sampleDomain != domain {
+				content += fmt.Sprintf("\n:warning: The sample URL is on `%v`, so this fixer would not apply to it.", sampleDomain)
+			}
+		}
+	}
+
+	buttons := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Save",
+					Style:    discordgo.SuccessButton,
+					Disabled: err != nil,
+					CustomID: c.customID(createFixerSave, draftID),
+				},
+				discordgo.Button{
+					Label:    "Edit",
+					Style:    discordgo.SecondaryButton,
+					CustomID: c.customID(createFixerEdit, draftID),
+				},
+				discordgo.Button{
+					Label:    "Cancel",
+					Style:    discordgo.DangerButton,
+					CustomID: c.customID(createFixerCancel, draftID),
+				},
+			},
+		},
+	}
+
+	// Editing a draft submits the modal from the preview's Edit button, in
+	// which case the existing preview is updated instead of posting a new one.
+	if i.Message != nil {
+		return updateResponse(content, buttons), nil
+	}
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: buttons,
+			Flags:      discordgo.MessageFlagsEphemeral,
+		},
+	}, nil
+}
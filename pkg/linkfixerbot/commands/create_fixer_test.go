@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+func TestFixerDraftBuild(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		want   fixer.Fixer
+	}{
+		{"Lines", `(www\.)?reddit\.com` + "\nold.reddit.com", fixer.RegexpReplaceFixer{Pattern: `(www\.)?reddit\.com`, Replacement: "old.reddit.com"}},
+		{"CRLF", `(www\.)?reddit\.com` + "\r\nold.reddit.com", fixer.RegexpReplaceFixer{Pattern: `(www\.)?reddit\.com`, Replacement: "old.reddit.com"}},
+		{"TrailingNewline", `(www\.)?reddit\.com` + "\nold.reddit.com\n", fixer.RegexpReplaceFixer{Pattern: `(www\.)?reddit\.com`, Replacement: "old.reddit.com"}},
+		{"BlankLinesAtEnds", "\n  \n" + `(www\.)?reddit\.com` + "\nold.reddit.com\r\n\r\n", fixer.RegexpReplaceFixer{Pattern: `(www\.)?reddit\.com`, Replacement: "old.reddit.com"}},
+		// Blank lines between parameters are empty parameters, making three
+		// here.
+		{"BlankLineBetween", `(www\.)?reddit\.com` + "\n\nold.reddit.com", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := fixerDraft{Domain: "reddit.com", Type: "regex", Params: tt.params}
+			got, domain, err := d.build()
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("build() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("build() failed: %v", err)
+			}
+			if domain != "reddit.com" || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("build() = %v, %q, want %v, %q", got, domain, tt.want, "reddit.com")
+			}
+		})
+	}
+}
+
+func TestCreateFixerModalFitsLimits(t *testing.T) {
+	// Discord rejects modals whose text inputs have longer labels or
+	// placeholders than these.
+	const (
+		maxLabel       = 45
+		maxPlaceholder = 100
+	)
+
+	resp := CreateFixerCommand{}.modal("1", fixerDraft{})
+	for _, row := range resp.Data.Components {
+		for _, c := range row.(discordgo.ActionsRow).Components {
+			input := c.(discordgo.TextInput)
+			if len(input.Label) > maxLabel {
+				t.Errorf("label of %v is %v characters, want at most %v", input.CustomID, len(input.Label), maxLabel)
+			}
+			if len(input.Placeholder) > maxPlaceholder {
+				t.Errorf("placeholder of %v is %v characters, want at most %v", input.CustomID, len(input.Placeholder), maxPlaceholder)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+type ExportFixersCommand struct {
+	Store fixer.Store
+}
+
+func (c ExportFixersCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "export",
+		Description: "Export this server's URL fixers as a CSV file that can be imported again",
+	}
+}
+
+func (c ExportFixersCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	return "", errors.New("export must be run with Respond")
+}
+
+func (c ExportFixersCommand) Respond(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (*discordgo.InteractionResponse, error) {
+	fixers, err := c.Store.List(scopeID(i))
+	if err != nil && !errors.Is(err, fixer.ErrGuildNotFound) {
+		return nil, fmt.Errorf("could not list fixers: %w", err)
+	}
+
+	if len(fixers) == 0 {
+		return messageResponse("No fixers found!"), nil
+	}
+
+	csv, err := fixer.FormatCSV(fixers)
+	if err != nil {
+		return messageResponse(fmt.Sprintf("Could not export fixers: %v", err)), nil
+	}
+
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("Exported %v fixers.", len(fixers)),
+			Files: []*discordgo.File{
+				{
+					Name:        "fixers.csv",
+					ContentType: "text/csv",
+					Reader:      strings.NewReader(csv),
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+type AddFallbackFixerCommand struct {
+	Store fixer.Store
+}
+
+func (c AddFallbackFixerCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "add",
+		Description: "Add a fixer to fall back to when a domain's fixed links are down",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "domain",
+				Description: "Domain whose fixer to add a fallback to",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+			{
+				Name:        "fixer",
+				Description: "Fallback fixer as a CSV row without the domain, e.g. prepend,https://example.com/",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+		},
+	}
+}
+
+func (c AddFallbackFixerCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	domain := fixer.ExtractDomain(opts["domain"].(string))
+
+	fallback, err := fixer.ParseFixer(opts["fixer"].(string))
+	if err != nil {
+		return fmt.Sprintf("Could not parse fallback fixer: %v", err), nil
+	}
+
+	f, err := c.Store.Get(scopeID(i), domain)
+	if errors.Is(err, fixer.ErrNotFound) {
+		return fmt.Sprintf("No fixer found for domain `%v`, add one before its fallbacks", domain), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not get fixer: %w", err)
+	}
+
+	f = fixer.WithFallback(f, fallback)
+	change, err := putFixer(c.Store, i, domain, f)
+	if err != nil {
+		return "", fmt.Errorf("storing fallback fixer failed: %w", err)
+	}
+	announceChanges(s, c.Store, i, change)
+
+	return fmt.Sprintf("Successfully registered fixer `%v` for domain `%v`", f.String(), domain), nil
+}
+
+type ClearFallbackFixersCommand struct {
+	Store fixer.Store
+}
+
+func (c ClearFallbackFixersCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "clear",
+		Description: "Remove a domain's fallback fixers, keeping only its first fixer",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "domain",
+				Description: "Domain whose fallbacks to remove",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+		},
+	}
+}
+
+func (c ClearFallbackFixersCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	domain := fixer.ExtractDomain(opts["domain"].(string))
+
+	f, err := c.Store.Get(scopeID(i), domain)
+	if errors.Is(err, fixer.ErrNotFound) {
+		return fmt.Sprintf("No fixer found for domain `%v`", domain), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not get fixer: %w", err)
+	}
+
+	ff, ok := f.(fixer.FallbackFixer)
+	if !ok || len(ff.Fixers) == 0 {
+		return fmt.Sprintf("The fixer for domain `%v` has no fallbacks", domain), nil
+	}
+
+	change, err := putFixer(c.Store, i, domain, ff.Fixers[0])
+	if err != nil {
+		return "", fmt.Errorf("storing fixer failed: %w", err)
+	}
+	announceChanges(s, c.Store, i, change)
+
+	return fmt.Sprintf("Successfully removed the fallbacks for domain `%v`", domain), nil
+}
@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+	"github.com/charmbracelet/log"
+)
+
+// FixLinksCommand is a message context menu command that fixes the links in
+// the message it is used on, e.g. when the message was posted before a
+// fixer existed.
+type FixLinksCommand struct {
+	Store fixer.Store
+	// Pipeline fixes the links, as for links in new messages.
+	Pipeline *fixer.Pipeline
+	// AttachmentDomains are the CDN domains whose attachment URLs are fixed,
+	// as with MessageText.
+	AttachmentDomains []string
+	// Context is cancelled when the bot shuts down, stopping link expansion
+	// and health checks.
+	Context context.Context
+}
+
+func (c FixLinksCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:             "Fix links",
+		Type:             discordgo.MessageApplicationCommand,
+		Contexts:         &PrivateContexts,
+		IntegrationTypes: &AllIntegrationTypes,
+	}
+}
+
+func (c FixLinksCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	return "", errors.New("fix links must be run with Respond")
+}
+
+// noFixesMessage is shown only to the user when none of a message's links
+// have a fixer.
+const noFixesMessage = "No links in this message have a fixer."
+
+// Respond defers the response before fixing the links, as expanding and
+// checking them can take longer than Discord waits for a response, and then
+// edits it to show the fixed links. It only responds directly if there are
+// no links that could be fixed.
+func (c FixLinksCommand) Respond(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (*discordgo.InteractionResponse, error) {
+	data := i.ApplicationCommandData()
+	target, ok := data.Resolved.Messages[data.TargetID]
+	if !ok {
+		return nil, fmt.Errorf("target message %v not resolved", data.TargetID)
+	}
+
+	settings, err := c.Store.GetSettings(scopeID(i))
+	if err != nil {
+		return nil, fmt.Errorf("could not get settings: %w", err)
+	}
+
+	text := MessageText(target, c.AttachmentDomains)
+	hasFixers, err := fixer.HasFixers(c.Store, scopeID(i), settings)
+	if err != nil {
+		return nil, fmt.Errorf("could not check for fixers: %w", err)
+	}
+	if len(fixer.ExtractURLs(text)) == 0 || !hasFixers {
+		return ephemeralResponse(noFixesMessage), nil
+	}
+
+	deferred := &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredChannelMessageWithSource}
+	if settings.PrivateManualFixes {
+		deferred.Data = &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral}
+	}
+	err = s.InteractionRespond(i.Interaction, deferred)
+	if err != nil {
+		return nil, fmt.Errorf("could not defer response: %w", err)
+	}
+
+	content := ""
+	fixes, err := c.Pipeline.FixLinks(c.Context, scopeID(i), text, settings)
+	if err != nil {
+		log.Error("could not fix links", "interactionID", i.ID, "err", err)
+		content = ":sob: Internal server error when running command"
+	}
+
+	var fixed []string
+	for _, fix := range fixes {
+		if !slices.Contains(fixed, fix.Fixed) {
+			fixed = append(fixed, fix.Fixed)
+		}
+	}
+	if len(fixed) > 0 {
+		content = strings.Join(fixed, "\n")
+	}
+
+	if content == "" {
+		// Only the user needs to know, so replace a public response with a
+		// message only they can see.
+		content = noFixesMessage
+		if !settings.PrivateManualFixes {
+			err = s.InteractionResponseDelete(i.Interaction)
+			if err != nil {
+				log.Error("could not delete deferred response", "interactionID", i.ID, "err", err)
+			}
+			_, err = s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
+				Content: content,
+				Flags:   discordgo.MessageFlagsEphemeral,
+			})
+			if err != nil {
+				log.Error("could not send response", "interactionID", i.ID, "err", err)
+			}
+			return nil, nil
+		}
+	}
+
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	if err != nil {
+		log.Error("could not edit deferred response", "interactionID", i.ID, "err", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// A recordedRequest is a request a test session made to the API.
+type recordedRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// newRecordingSession returns a session whose API requests all succeed and
+// are recorded in order.
+func newRecordingSession(t *testing.T) (*discordgo.Session, func() []recordedRequest) {
+	s, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatalf("could not create session: %v", err)
+	}
+
+	var mu sync.Mutex
+	var requests []recordedRequest
+	s.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var body []byte
+		if req.Body != nil {
+			body, _ = io.ReadAll(req.Body)
+		}
+		mu.Lock()
+		requests = append(requests, recordedRequest{
+			Method: req.Method,
+			Path:   strings.TrimPrefix(req.URL.Path, "/api/v"+discordgo.APIVersion),
+			Body:   string(body),
+		})
+		mu.Unlock()
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Body:       io.NopCloser(strings.NewReader(`{}`)),
+			Header:     http.Header{},
+			Request:    req,
+		}, nil
+	})}
+
+	return s, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedRequest(nil), requests...)
+	}
+}
+
+// fixLinksInteraction returns a Fix links interaction in the test guild on
+// a message with content.
+func fixLinksInteraction(content string) *discordgo.InteractionCreate {
+	i := testInteraction()
+	i.ID = "800000000000000200"
+	i.AppID = "800000000000000099"
+	i.Token = "token"
+	i.Data = discordgo.ApplicationCommandInteractionData{
+		Name:     "Fix links",
+		TargetID: "800000000000000201",
+		Resolved: &discordgo.ApplicationCommandInteractionDataResolved{
+			Messages: map[string]*discordgo.Message{
+				"800000000000000201": {ID: "800000000000000201", Content: content},
+			},
+		},
+	}
+	return i
+}
+
+func TestFixLinksDefersResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		private   bool
+		wantFlags discordgo.MessageFlags
+	}{
+		{"Public", false, 0},
+		{"Private", true, discordgo.MessageFlagsEphemeral},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := fixer.NewMemoryStore()
+			_, err := store.Put(testGuildID, "twitter.com", fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"}, testUserID)
+			if err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			err = store.PutSettings(testGuildID, fixer.GuildSettings{PrivateManualFixes: tt.private})
+			if err != nil {
+				t.Fatalf("PutSettings failed: %v", err)
+			}
+
+			s, requests := newRecordingSession(t)
+			c := FixLinksCommand{Store: store, Pipeline: &fixer.Pipeline{Store: store}, Context: context.Background()}
+			i := fixLinksInteraction("see https://twitter.com/golang/status/1")
+
+			resp, err := c.Respond(s, i, nil)
+			if err != nil {
+				t.Fatalf("Respond failed: %v", err)
+			}
+			if resp != nil {
+				t.Errorf("Respond = %+v, want nil after deferring", resp)
+			}
+
+			got := requests()
+			if len(got) != 2 {
+				t.Fatalf("made requests %+v, want a deferred response and an edit", got)
+			}
+
+			// The deferred response comes first, before any links are
+			// expanded or checked.
+			if want := "/interactions/" + i.ID + "/" + i.Token + "/callback"; got[0].Method != http.MethodPost || got[0].Path != want {
+				t.Errorf("first request = %v %v, want POST %v", got[0].Method, got[0].Path, want)
+			}
+			var deferred discordgo.InteractionResponse
+			err = json.Unmarshal([]byte(got[0].Body), &deferred)
+			if err != nil {
+				t.Fatalf("could not decode deferred response: %v", err)
+			}
+			var flags discordgo.MessageFlags
+			if deferred.Data != nil {
+				flags = deferred.Data.Flags
+			}
+			if deferred.Type != discordgo.InteractionResponseDeferredChannelMessageWithSource || flags != tt.wantFlags {
+				t.Errorf("deferred response = type %v with flags %v, want type %v with flags %v", deferred.Type, flags, discordgo.InteractionResponseDeferredChannelMessageWithSource, tt.wantFlags)
+			}
+
+			if want := "/webhooks/" + i.AppID + "/" + i.Token + "/messages/@original"; got[1].Method != http.MethodPatch || got[1].Path != want {
+				t.Errorf("second request = %v %v, want PATCH %v", got[1].Method, got[1].Path, want)
+			}
+			if !strings.Contains(got[1].Body, "https://vxtwitter.com/golang/status/1") {
+				t.Errorf("edit = %v, want the fixed link", got[1].Body)
+			}
+		})
+	}
+}
+
+func TestFixLinksWithoutFixableLinks(t *testing.T) {
+	store := fixer.NewMemoryStore()
+	s, requests := newRecordingSession(t)
+	c := FixLinksCommand{Store: store, Pipeline: &fixer.Pipeline{Store: store}, Context: context.Background()}
+
+	resp, err := c.Respond(s, fixLinksInteraction("see https://twitter.com/golang/status/1"), nil)
+	if err != nil {
+		t.Fatalf("Respond failed: %v", err)
+	}
+	if resp == nil || resp.Data.Flags != discordgo.MessageFlagsEphemeral {
+		t.Errorf("Respond = %+v, want an ephemeral response", resp)
+	}
+	if got := requests(); len(got) != 0 {
+		t.Errorf("made requests %+v, want none", got)
+	}
+}
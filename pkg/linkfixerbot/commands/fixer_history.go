@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// maxHistoryEntries is the number of changes shown by /fixer history.
+const maxHistoryEntries = 10
+
+type FixerHistoryCommand struct {
+	Store fixer.Store
+}
+
+func (c FixerHistoryCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "history",
+		Description: "Show recent changes to this server's URL fixers",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "domain",
+				Description: "Only show changes to the fixer for this domain",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    false,
+			},
+		},
+	}
+}
+
+func (c FixerHistoryCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	domain := ""
+	if d, ok := opts["domain"]; ok {
+		domain = fixer.ExtractDomain(d.(string))
+	}
+
+	changes, err := c.Store.History(scopeID(i), domain)
+	if err != nil {
+		return "", fmt.Errorf("could not get fixer history: %w", err)
+	}
+
+	if len(changes) == 0 {
+		return "No changes found!", nil
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString("Recent fixer changes:\n")
+	for _, change := range changes[:min(len(changes), maxHistoryEntries)] {
+		builder.WriteString(fmt.Sprintf("- <t:%v:R> <@%v> %v\n", change.Time.Unix(), change.ActorID, change.String()))
+	}
+	if len(changes) > maxHistoryEntries {
+		builder.WriteString(fmt.Sprintf("…and %v older changes", len(changes)-maxHistoryEntries))
+	}
+
+	return builder.String(), nil
+}
+
+type UndoFixerChangeCommand struct {
+	Store fixer.Store
+}
+
+func (c UndoFixerChangeCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "undo",
+		Description: "Restore a fixer to its value before the most recent change that has not been undone",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "domain",
+				Description: "Domain whose last change to undo (defaults to the last change on this server)",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    false,
+			},
+		},
+	}
+}
+
+func (c UndoFixerChangeCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	domain := ""
+	if d, ok := opts["domain"]; ok {
+		domain = fixer.ExtractDomain(d.(string))
+	}
+
+	changes, err := c.Store.History(scopeID(i), domain)
+	if err != nil {
+		return "", fmt.Errorf("could not get fixer history: %w", err)
+	}
+
+	last, ok := fixer.LastUndoable(changes)
+	if !ok {
+		return "No changes to undo!", nil
+	}
+
+	change, changed, err := undoChange(c.Store, i, last)
+	if err != nil {
+		return "", fmt.Errorf("undoing fixer change failed: %w", err)
+	}
+	if changed {
+		announceChanges(s, c.Store, i, change)
+	}
+
+	return fmt.Sprintf("Successfully undid change: %v", last.String()), nil
+}
@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A Router is a Command made up of subcommands.
+type Router interface {
+	Command
+	Subcommand(name string) (Command, bool)
+}
+
+// A Group is a command whose subcommands are themselves Commands, routed by
+// the names in their templates. Subcommands that are Groups become
+// subcommand groups, so new subcommands can be added anywhere in the tree
+// by adding them to a Group.
+//
+// Discord only supports default member permissions, contexts and
+// integration types on top-level commands, so they are ignored on nested
+// Groups and subcommands.
+type Group struct {
+	Name                     string
+	Description              string
+	DefaultMemberPermissions *int64
+	Contexts                 *[]discordgo.InteractionContextType
+	IntegrationTypes         *[]discordgo.ApplicationIntegrationType
+	Subcommands              []Command
+}
+
+func (g Group) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	var options []*discordgo.ApplicationCommandOption
+	for _, sub := range g.Subcommands {
+		t := sub.ApplicationCommandTemplate()
+
+		optionType := discordgo.ApplicationCommandOptionSubCommand
+		if _, ok := sub.(Router); ok {
+			optionType = discordgo.ApplicationCommandOptionSubCommandGroup
+		}
+
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Name:        t.Name,
+			Description: t.Description,
+			Type:        optionType,
+			Options:     t.Options,
+		})
+	}
+
+	return &discordgo.ApplicationCommand{
+		Name:                     g.Name,
+		Description:              g.Description,
+		DefaultMemberPermissions: g.DefaultMemberPermissions,
+		Contexts:                 g.Contexts,
+		IntegrationTypes:         g.IntegrationTypes,
+		Options:                  options,
+	}
+}
+
+// Subcommand returns the subcommand with the given name.
+func (g Group) Subcommand(name string) (Command, bool) {
+	for _, sub := range g.Subcommands {
+		if sub.ApplicationCommandTemplate().Name == name {
+			return sub, true
+		}
+	}
+	return nil, false
+}
+
+func (g Group) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	return "", fmt.Errorf("command group %v cannot be run without a subcommand", g.Name)
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// maxGuildSizeEntries is the number of guilds shown by /linkfixer guild-sizes.
+const maxGuildSizeEntries = 20
+
+type GuildSizesCommand struct {
+	Store     fixer.Store
+	Operators *Operators
+}
+
+func (c GuildSizesCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "guild-sizes",
+		Description: "List the servers with the most stored fixers (bot operators only)",
+	}
+}
+
+func (c GuildSizesCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	if !c.Operators.Allowed(i) {
+		return ":no_entry: Only the bot's operators can use this command.", nil
+	}
+
+	sizes, err := c.Store.Sizes()
+	if err != nil {
+		return "", fmt.Errorf("could not get guild sizes: %w", err)
+	}
+	// Users' personal fixers are not a guild's.
+	maps.DeleteFunc(sizes, func(guildID string, _ int) bool {
+		return fixer.IsUserScope(guildID)
+	})
+
+	departed, err := c.Store.Departed()
+	if err != nil {
+		return "", fmt.Errorf("could not get departed guilds: %w", err)
+	}
+
+	if len(sizes) == 0 {
+		return "No guilds found!", nil
+	}
+
+	guildIDs := make([]string, 0, len(sizes))
+	total := 0
+	for guildID, n := range sizes {
+		guildIDs = append(guildIDs, guildID)
+		total += n
+	}
+	slices.SortFunc(guildIDs, func(a, b string) int {
+		return cmp.Compare(sizes[b], sizes[a])
+	})
+
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("%v fixers stored across %v guilds:\n", total, len(sizes)))
+	for _, guildID := range guildIDs[:min(len(guildIDs), maxGuildSizeEntries)] {
+		builder.WriteString(fmt.Sprintf("- `%v`: %v fixers", guildID, sizes[guildID]))
+		if at, ok := departed[guildID]; ok {
+			builder.WriteString(fmt.Sprintf(" (left <t:%v:R>)", at.Unix()))
+		}
+		builder.WriteString("\n")
+	}
+
+	return builder.String(), nil
+}
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -14,26 +15,59 @@ type ListFixersCommand struct {
 
 func (c ListFixersCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
 	return &discordgo.ApplicationCommand{
-		Name:        "list-fixers",
+		Name:        "list",
 		Description: "List all registered URL fixers for this server",
 	}
 }
 
-func (c ListFixersCommand) Run(i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
-	fixers, err := c.Store.List(i.GuildID)
-	if err != nil {
+func (c ListFixersCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	fixers, err := c.Store.List(scopeID(i))
+	if err != nil && !errors.Is(err, fixer.ErrGuildNotFound) {
 		return "", fmt.Errorf("could not list fixers: %w", err)
 	}
 
-	if len(fixers) == 0 {
+	globalFixers, err := c.globalFixers(scopeID(i))
+	if err != nil {
+		return "", err
+	}
+	for domain := range fixers {
+		delete(globalFixers, domain)
+	}
+
+	if len(fixers) == 0 && len(globalFixers) == 0 {
 		return "No fixers found!", nil
 	}
 
 	builder := strings.Builder{}
-	builder.WriteString("Currently registered fixers:\n")
-	for domain, fixer := range fixers {
-		builder.WriteString(fmt.Sprintf("- `%v` → `%v`", domain, fixer.String()))
+	if len(fixers) > 0 {
+		builder.WriteString("Currently registered fixers:\n")
+		for domain, fixer := range fixers {
+			builder.WriteString(fmt.Sprintf("- `%v` → `%v`\n", domain, fixer.String()))
+		}
+	}
+	if len(globalFixers) > 0 {
+		builder.WriteString("Default fixers:\n")
+		for domain, fixer := range globalFixers {
+			builder.WriteString(fmt.Sprintf("- `%v` → `%v`\n", domain, fixer.String()))
+		}
 	}
 
 	return builder.String(), nil
 }
+
+// globalFixers returns the global fixers that apply in the guild.
+func (c ListFixersCommand) globalFixers(guildID string) (map[string]fixer.Fixer, error) {
+	settings, err := c.Store.GetSettings(guildID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get settings: %w", err)
+	}
+	if settings.IgnoreGlobalFixers {
+		return nil, nil
+	}
+
+	fixers, err := c.Store.List(fixer.GlobalScope)
+	if err != nil && !errors.Is(err, fixer.ErrGuildNotFound) {
+		return nil, fmt.Errorf("could not list global fixers: %w", err)
+	}
+	return fixers, nil
+}
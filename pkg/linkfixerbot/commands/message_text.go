@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// MessageText returns the text links are read from in m: its content,
+// followed by the URLs of its embeds, and of its attachments hosted on
+// attachmentDomains, that are not already in the content. URLs are compared
+// as by sameLinkKey.
+func MessageText(m *discordgo.Message, attachmentDomains []string) string {
+	var lines []string
+	if m.Content != "" {
+		lines = append(lines, m.Content)
+	}
+
+	seen := map[string]bool{}
+	for _, link := range fixer.ExtractURLs(m.Content) {
+		seen[sameLinkKey(link)] = true
+	}
+	add := func(link string) {
+		if link != "" && !seen[sameLinkKey(link)] {
+			seen[sameLinkKey(link)] = true
+			lines = append(lines, link)
+		}
+	}
+
+	for _, embed := range m.Embeds {
+		add(embed.URL)
+	}
+	for _, attachment := range m.Attachments {
+		u, err := url.Parse(attachment.URL)
+		if err == nil && slices.Contains(attachmentDomains, u.Hostname()) {
+			add(attachment.URL)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// sameLinkKey returns a key that is equal for links to the same page, as
+// Discord may give an embed's URL with a different scheme or host case, or
+// with or without a trailing slash, than the link it was made from.
+func sameLinkKey(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return link
+	}
+	return strings.ToLower(u.Host) + strings.TrimSuffix(u.EscapedPath(), "/") + "?" + u.RawQuery
+}
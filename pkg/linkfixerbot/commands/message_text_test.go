@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMessageText(t *testing.T) {
+	cdn := []string{"cdn.discordapp.com"}
+
+	tests := []struct {
+		name string
+		m    *discordgo.Message
+		want string
+	}{
+		{"Content", &discordgo.Message{Content: "see https://twitter.com/a/status/1"}, "see https://twitter.com/a/status/1"},
+		{"EmbedOnly", &discordgo.Message{
+			Embeds: []*discordgo.MessageEmbed{{URL: "https://twitter.com/a/status/1"}},
+		}, "https://twitter.com/a/status/1"},
+		{"EmbedOfContentLink", &discordgo.Message{
+			Content: "see https://twitter.com/a/status/1",
+			Embeds:  []*discordgo.MessageEmbed{{URL: "https://twitter.com/a/status/1"}},
+		}, "see https://twitter.com/a/status/1"},
+		// Embed URLs can differ from the link they were made from in their
+		// scheme, host case and trailing slash.
+		{"EmbedOfContentLinkNormalized", &discordgo.Message{
+			Content: "see http://Twitter.com/a/status/1",
+			Embeds:  []*discordgo.MessageEmbed{{URL: "https://twitter.com/a/status/1/"}},
+		}, "see http://Twitter.com/a/status/1"},
+		{"EmbedsOfDifferentPages", &discordgo.Message{
+			Embeds: []*discordgo.MessageEmbed{
+				{URL: "https://twitter.com/a/status/1"},
+				{URL: "https://twitter.com/a/status/1?s=20"},
+				{URL: "https://twitter.com/a/status/2"},
+				{URL: "https://twitter.com/a/status/2/"},
+			},
+		}, "https://twitter.com/a/status/1\nhttps://twitter.com/a/status/1?s=20\nhttps://twitter.com/a/status/2"},
+		{"Attachments", &discordgo.Message{
+			Attachments: []*discordgo.MessageAttachment{
+				{URL: "https://cdn.discordapp.com/attachments/1/2/a.mp4"},
+				{URL: "https://media.example/a.mp4"},
+			},
+		}, "https://cdn.discordapp.com/attachments/1/2/a.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MessageText(tt.m, cdn); got != tt.want {
+				t.Errorf("MessageText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
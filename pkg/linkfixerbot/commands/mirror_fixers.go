@@ -0,0 +1,278 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// mirrorStrategyChoices returns a choice for every mirror strategy.
+func mirrorStrategyChoices() []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, strategy := range fixer.MirrorStrategies {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  string(strategy),
+			Value: string(strategy),
+		})
+	}
+	return choices
+}
+
+// A domainMirror is the MirrorFixer of a domain, which is either the
+// domain's fixer or one of the fixers of its FallbackFixer.
+type domainMirror struct {
+	fixer.MirrorFixer
+
+	// fallback is the domain's FallbackFixer, and index the position of the
+	// mirror fixer in it, if it has one.
+	fallback fixer.FallbackFixer
+	index    int
+}
+
+// replace returns the domain's fixer with its mirror fixer replaced by mf.
+func (dm domainMirror) replace(mf fixer.MirrorFixer) fixer.Fixer {
+	if dm.fallback.Fixers == nil {
+		return mf
+	}
+	fixers := slices.Clone(dm.fallback.Fixers)
+	fixers[dm.index] = mf
+	return fixer.FallbackFixer{Fixers: fixers}
+}
+
+// getMirrorFixer returns the domain's MirrorFixer, or a message for the user
+// if it does not have one.
+func getMirrorFixer(store fixer.Store, i *discordgo.InteractionCreate, domain string) (domainMirror, string, error) {
+	f, err := store.Get(scopeID(i), domain)
+	if errors.Is(err, fixer.ErrNotFound) {
+		return domainMirror{}, fmt.Sprintf("No fixer found for domain `%v`", domain), nil
+	}
+	if err != nil {
+		return domainMirror{}, "", fmt.Errorf("could not get fixer: %w", err)
+	}
+
+	switch f := f.(type) {
+	case fixer.MirrorFixer:
+		return domainMirror{MirrorFixer: f}, "", nil
+	case fixer.FallbackFixer:
+		for n, ff := range f.Fixers {
+			if mf, ok := ff.(fixer.MirrorFixer); ok {
+				return domainMirror{MirrorFixer: mf, fallback: f, index: n}, "", nil
+			}
+		}
+	}
+	return domainMirror{}, fmt.Sprintf("The fixer for domain `%v` is not a mirror fixer", domain), nil
+}
+
+type RegisterMirrorFixerCommand struct {
+	Store fixer.Store
+}
+
+func (c RegisterMirrorFixerCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "add",
+		Description: "Register a URL fixer that points links at one of several frontend instances",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "domain",
+				Description: "Domain this fixer will apply to",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+			{
+				Name:        "instances",
+				Description: "Comma-separated hosts of the instances, e.g. yewtu.be,inv.nadeko.net",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+			{
+				Name:        "strategy",
+				Description: "How an instance is chosen for each link (defaults to first-healthy)",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    false,
+				Choices:     mirrorStrategyChoices(),
+			},
+		},
+	}
+}
+
+func (c RegisterMirrorFixerCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	domain := fixer.ExtractDomain(opts["domain"].(string))
+
+	strategy := fixer.MirrorFirstHealthy
+	if value, ok := opts["strategy"].(string); ok {
+		strategy = fixer.MirrorStrategy(value)
+	}
+
+	f, err := fixer.NewMirrorFixer(strategy, strings.Split(opts["instances"].(string), ","))
+	if err != nil {
+		return fmt.Sprintf("Could not create mirror fixer: %v", err), nil
+	}
+
+	change, err := putFixer(c.Store, i, domain, f)
+	if err != nil {
+		return "", fmt.Errorf("storing mirror fixer failed: %w", err)
+	}
+	announceChanges(s, c.Store, i, change)
+
+	return fmt.Sprintf("Successfully registered fixer `%v` for domain `%v`", f.String(), domain), nil
+}
+
+type AddMirrorInstanceCommand struct {
+	Store fixer.Store
+}
+
+func (c AddMirrorInstanceCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "add-instance",
+		Description: "Add an instance to a mirror fixer",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "domain",
+				Description: "Domain of the mirror fixer",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+			{
+				Name:        "instance",
+				Description: "Host of the instance to add",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+		},
+	}
+}
+
+func (c AddMirrorInstanceCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	domain := fixer.ExtractDomain(opts["domain"].(string))
+
+	dm, msg, err := getMirrorFixer(c.Store, i, domain)
+	if msg != "" || err != nil {
+		return msg, err
+	}
+
+	instance, err := fixer.MirrorInstanceHost(opts["instance"].(string))
+	if err != nil {
+		return fmt.Sprintf("Could not add instance: %v", err), nil
+	}
+	if slices.Contains(dm.Instances, instance) {
+		return fmt.Sprintf("The mirror fixer for domain `%v` already has instance `%v`", domain, instance), nil
+	}
+
+	mf := dm.MirrorFixer
+	mf.Instances = append(slices.Clone(mf.Instances), instance)
+	change, err := putFixer(c.Store, i, domain, dm.replace(mf))
+	if err != nil {
+		return "", fmt.Errorf("storing mirror fixer failed: %w", err)
+	}
+	announceChanges(s, c.Store, i, change)
+
+	return fmt.Sprintf("Added instance `%v` to the mirror fixer for domain `%v`, which now points links at `%v`", instance, domain, strings.Join(mf.Instances, ", ")), nil
+}
+
+type RemoveMirrorInstanceCommand struct {
+	Store fixer.Store
+}
+
+func (c RemoveMirrorInstanceCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "remove-instance",
+		Description: "Remove an instance from a mirror fixer",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "domain",
+				Description: "Domain of the mirror fixer",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+			{
+				Name:        "instance",
+				Description: "Host of the instance to remove",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+		},
+	}
+}
+
+func (c RemoveMirrorInstanceCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	domain := fixer.ExtractDomain(opts["domain"].(string))
+
+	dm, msg, err := getMirrorFixer(c.Store, i, domain)
+	if msg != "" || err != nil {
+		return msg, err
+	}
+
+	instance, err := fixer.MirrorInstanceHost(opts["instance"].(string))
+	if err != nil {
+		return fmt.Sprintf("Could not remove instance: %v", err), nil
+	}
+	n := slices.Index(dm.Instances, instance)
+	if n < 0 {
+		return fmt.Sprintf("The mirror fixer for domain `%v` has no instance `%v`", domain, instance), nil
+	}
+	if len(dm.Instances) == 1 {
+		return fmt.Sprintf("Cannot remove the last instance of the mirror fixer for domain `%v`, delete the fixer instead", domain), nil
+	}
+
+	mf := dm.MirrorFixer
+	mf.Instances = slices.Delete(slices.Clone(mf.Instances), n, n+1)
+	change, err := putFixer(c.Store, i, domain, dm.replace(mf))
+	if err != nil {
+		return "", fmt.Errorf("storing mirror fixer failed: %w", err)
+	}
+	announceChanges(s, c.Store, i, change)
+
+	return fmt.Sprintf("Removed instance `%v` from the mirror fixer for domain `%v`, which now points links at `%v`", instance, domain, strings.Join(mf.Instances, ", ")), nil
+}
+
+type SetMirrorStrategyCommand struct {
+	Store fixer.Store
+}
+
+func (c SetMirrorStrategyCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "strategy",
+		Description: "Change how a mirror fixer chooses an instance for each link",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "domain",
+				Description: "Domain of the mirror fixer",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+			{
+				Name:        "strategy",
+				Description: "How an instance is chosen for each link",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+				Choices:     mirrorStrategyChoices(),
+			},
+		},
+	}
+}
+
+func (c SetMirrorStrategyCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	domain := fixer.ExtractDomain(opts["domain"].(string))
+
+	dm, msg, err := getMirrorFixer(c.Store, i, domain)
+	if msg != "" || err != nil {
+		return msg, err
+	}
+
+	mf, err := fixer.NewMirrorFixer(fixer.MirrorStrategy(opts["strategy"].(string)), dm.Instances)
+	if err != nil {
+		return fmt.Sprintf("Could not change strategy: %v", err), nil
+	}
+
+	change, err := putFixer(c.Store, i, domain, dm.replace(mf))
+	if err != nil {
+		return "", fmt.Errorf("storing mirror fixer failed: %w", err)
+	}
+	announceChanges(s, c.Store, i, change)
+
+	return fmt.Sprintf("Changed the strategy of the mirror fixer for domain `%v` to `%v`", domain, mf.Strategy), nil
+}
@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Operators is the set of users allowed to run operator-only commands. It is
+// safe for concurrent use.
+type Operators struct {
+	mu  sync.RWMutex
+	ids map[string]bool
+}
+
+// Add adds users to the set of operators.
+func (o *Operators) Add(userIDs ...string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.ids == nil {
+		o.ids = map[string]bool{}
+	}
+	for _, id := range userIDs {
+		o.ids[id] = true
+	}
+}
+
+// Allowed reports whether the user who triggered the interaction is an
+// operator.
+func (o *Operators) Allowed(i *discordgo.InteractionCreate) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return o.ids[interactionUserID(i)]
+}
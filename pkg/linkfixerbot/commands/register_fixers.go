@@ -14,7 +14,7 @@ type RegisterReplaceFixerCommand struct {
 
 func (c RegisterReplaceFixerCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
 	return &discordgo.ApplicationCommand{
-		Name:        "replace-fixer",
+		Name:        "replace",
 		Description: "Register a URL fixer that replaces one substring in a URL with another",
 		Options: []*discordgo.ApplicationCommandOption{
 			{
@@ -39,17 +39,18 @@ func (c RegisterReplaceFixerCommand) ApplicationCommandTemplate() *discordgo.App
 	}
 }
 
-func (c RegisterReplaceFixerCommand) Run(i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+func (c RegisterReplaceFixerCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
 	domain := fixer.ExtractDomain(opts["domain"].(string))
 	f := fixer.ReplaceFixer{
 		Old: opts["old"].(string),
 		New: opts["new"].(string),
 	}
 
-	err := c.Store.Put(i.GuildID, domain, f)
+	change, err := putFixer(c.Store, i, domain, f)
 	if err != nil {
 		return "", fmt.Errorf("storing prepend fixer failed: %w", err)
 	}
+	announceChanges(s, c.Store, i, change)
 
 	return fmt.Sprintf("Successfully registered replace fixer `%v` for domain `%v`", f.String(), domain), nil
 }
@@ -60,8 +61,8 @@ type RegisterRegexpReplaceFixerCommand struct {
 
 func (c RegisterRegexpReplaceFixerCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
 	return &discordgo.ApplicationCommand{
-		Name:        "regexp-replace-fixer",
-		Description: "Register a URL fixer that replaces one substring in a URL with another",
+		Name:        "regex",
+		Description: "Register a URL fixer that replaces regular expression matches in a URL",
 		Options: []*discordgo.ApplicationCommandOption{
 			{
 				Name:        "domain",
@@ -85,7 +86,7 @@ func (c RegisterRegexpReplaceFixerCommand) ApplicationCommandTemplate() *discord
 	}
 }
 
-func (c RegisterRegexpReplaceFixerCommand) Run(i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+func (c RegisterRegexpReplaceFixerCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
 	domain := fixer.ExtractDomain(opts["domain"].(string))
 	f := fixer.RegexpReplaceFixer{
 		Pattern:     opts["pattern"].(string),
@@ -94,13 +95,14 @@ func (c RegisterRegexpReplaceFixerCommand) Run(i *discordgo.InteractionCreate, o
 
 	_, err := regexp.Compile(f.Pattern)
 	if err != nil {
-		return "could not compile regular expression `%v`", nil
+		return fmt.Sprintf("Could not compile regular expression `%v`: %v", f.Pattern, err), nil
 	}
 
-	err = c.Store.Put(i.GuildID, domain, f)
+	change, err := putFixer(c.Store, i, domain, f)
 	if err != nil {
 		return "", fmt.Errorf("storing prepend fixer failed: %w", err)
 	}
+	announceChanges(s, c.Store, i, change)
 
 	return fmt.Sprintf("Successfully registered fixer `%v` for domain `%v`", f.String(), domain), nil
 }
@@ -111,7 +113,7 @@ type RegisterPrependFixerCommand struct {
 
 func (c RegisterPrependFixerCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
 	return &discordgo.ApplicationCommand{
-		Name:        "prepend-fixer",
+		Name:        "prepend",
 		Description: "Register a URL fixer that prepends a string to a URL",
 		Options: []*discordgo.ApplicationCommandOption{
 			{
@@ -130,16 +132,66 @@ func (c RegisterPrependFixerCommand) ApplicationCommandTemplate() *discordgo.App
 	}
 }
 
-func (c RegisterPrependFixerCommand) Run(i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+func (c RegisterPrependFixerCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
 	domain := fixer.ExtractDomain(opts["domain"].(string))
 	f := fixer.PrependFixer{
 		Prefix: opts["prefix"].(string),
 	}
 
-	err := c.Store.Put(i.GuildID, domain, f)
+	change, err := putFixer(c.Store, i, domain, f)
 	if err != nil {
 		return "", fmt.Errorf("storing prepend fixer failed: %w", err)
 	}
+	announceChanges(s, c.Store, i, change)
+
+	return fmt.Sprintf("Successfully registered fixer `%v` for domain `%v`", f.String(), domain), nil
+}
+
+type RegisterTemplateFixerCommand struct {
+	Store fixer.Store
+}
+
+func (c RegisterTemplateFixerCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "template",
+		Description: "Register a URL fixer that builds URLs from a template over the URL's parts",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "domain",
+				Description: "Domain this fixer will apply to",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+			{
+				Name:        "template",
+				Description: "Go template, e.g. https://vxtwitter.com{{.Path}}",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+			{
+				Name:        "pattern",
+				Description: "Regular expression URLs must match, captures available as .Captures",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    false,
+			},
+		},
+	}
+}
+
+func (c RegisterTemplateFixerCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	domain := fixer.ExtractDomain(opts["domain"].(string))
+	pattern, _ := opts["pattern"].(string)
+
+	f, err := fixer.NewTemplateFixer(opts["template"].(string), pattern)
+	if err != nil {
+		return fmt.Sprintf("Could not register template fixer: %v", err), nil
+	}
+
+	change, err := putFixer(c.Store, i, domain, f)
+	if err != nil {
+		return "", fmt.Errorf("storing template fixer failed: %w", err)
+	}
+	announceChanges(s, c.Store, i, change)
 
 	return fmt.Sprintf("Successfully registered fixer `%v` for domain `%v`", f.String(), domain), nil
 }
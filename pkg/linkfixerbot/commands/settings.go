@@ -0,0 +1,162 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// settingChoices returns a choice for every guild setting.
+func settingChoices() []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, setting := range fixer.Settings {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  setting.Name,
+			Value: setting.Name,
+		})
+	}
+	return choices
+}
+
+type ViewSettingsCommand struct {
+	Store fixer.Store
+}
+
+func (c ViewSettingsCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "view",
+		Description: "Show this server's settings",
+	}
+}
+
+func (c ViewSettingsCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	settings, err := c.Store.GetSettings(i.GuildID)
+	if err != nil {
+		return "", fmt.Errorf("could not get settings: %w", err)
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString("Current settings:\n")
+	for _, setting := range fixer.Settings {
+		builder.WriteString(fmt.Sprintf("- `%v`: %v\n  -# %v\n", setting.Name, setting.Get(settings), setting.Description))
+	}
+
+	return builder.String(), nil
+}
+
+type SetSettingCommand struct {
+	Store fixer.Store
+}
+
+func (c SetSettingCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "set",
+		Description: "Change a setting",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "setting",
+				Description: "Setting to change",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+				Choices:     settingChoices(),
+			},
+			{
+				Name:        "value",
+				Description: "New value",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+		},
+	}
+}
+
+func (c SetSettingCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	name := opts["setting"].(string)
+	setting, ok := fixer.LookupSetting(name)
+	if !ok {
+		return fmt.Sprintf("Unknown setting `%v`", name), nil
+	}
+
+	settings, err := c.Store.GetSettings(i.GuildID)
+	if err != nil {
+		return "", fmt.Errorf("could not get settings: %w", err)
+	}
+
+	previousLogChannelID := settings.LogChannelID
+	err = setting.Set(&settings, strings.TrimSpace(opts["value"].(string)))
+	if err == nil {
+		err = settings.Validate()
+	}
+	if err != nil {
+		return fmt.Sprintf("Could not set `%v`: %v", name, err), nil
+	}
+
+	// Validate only checks the format of IDs, so check that the log
+	// channel is one of the guild's before posting there.
+	if settings.LogChannelID != "" && settings.LogChannelID != previousLogChannelID {
+		problem, err := checkLogChannel(s, i.GuildID, settings.LogChannelID)
+		if err != nil {
+			return "", err
+		}
+		if problem != "" {
+			return fmt.Sprintf("Could not set `%v`: %v", name, problem), nil
+		}
+	}
+
+	err = c.Store.PutSettings(i.GuildID, settings)
+	if err != nil {
+		return "", fmt.Errorf("storing settings failed: %w", err)
+	}
+
+	return fmt.Sprintf("Successfully set `%v` to %v", name, setting.Get(settings)), nil
+}
+
+type ResetSettingsCommand struct {
+	Store fixer.Store
+}
+
+func (c ResetSettingsCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "reset",
+		Description: "Reset a setting, or all settings, to the default",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "setting",
+				Description: "Setting to reset (defaults to all settings)",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    false,
+				Choices:     settingChoices(),
+			},
+		},
+	}
+}
+
+func (c ResetSettingsCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	settings, err := c.Store.GetSettings(i.GuildID)
+	if err != nil {
+		return "", fmt.Errorf("could not get settings: %w", err)
+	}
+
+	name, _ := opts["setting"].(string)
+	if name == "" {
+		settings = fixer.GuildSettings{}
+	} else {
+		setting, ok := fixer.LookupSetting(name)
+		if !ok {
+			return fmt.Sprintf("Unknown setting `%v`", name), nil
+		}
+		setting.Reset(&settings)
+	}
+
+	err = c.Store.PutSettings(i.GuildID, settings)
+	if err != nil {
+		return "", fmt.Errorf("storing settings failed: %w", err)
+	}
+
+	if name == "" {
+		return "Successfully reset all settings to their defaults", nil
+	}
+	return fmt.Sprintf("Successfully reset `%v` to its default", name), nil
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+type TestFixerCommand struct {
+	Store fixer.Store
+}
+
+func (c TestFixerCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "test",
+		Description: "Show how a link would be fixed in this server",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "url",
+				Description: "Link to fix",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Required:    true,
+			},
+		},
+	}
+}
+
+func (c TestFixerCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	url := opts["url"].(string)
+	domain := fixer.ExtractDomain(url)
+
+	f, err := fixer.Lookup(c.Store, scopeID(i), domain)
+	if errors.Is(err, fixer.ErrNotFound) {
+		return fmt.Sprintf("No fixer applies to domain `%v`", domain), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not look up fixer: %w", err)
+	}
+
+	settings, err := c.Store.GetSettings(scopeID(i))
+	if err != nil {
+		return "", fmt.Errorf("could not get settings: %w", err)
+	}
+
+	return fmt.Sprintf("Fixer `%v` for domain `%v` turns\n`%v`\ninto\n`%v`", f.String(), domain, opts["url"], fixer.ApplyFixer(f, url, settings)), nil
+}
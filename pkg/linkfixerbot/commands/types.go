@@ -6,5 +6,44 @@ import (
 
 type Command interface {
 	ApplicationCommandTemplate() *discordgo.ApplicationCommand
-	Run(i *discordgo.InteractionCreate, opts map[string]any) (string, error)
+	Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error)
+}
+
+// A RichCommand is a Command that needs more control over its response than
+// a plain text message, e.g. to attach files. Respond is called instead of
+// Run for RichCommands.
+type RichCommand interface {
+	Command
+	Respond(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (*discordgo.InteractionResponse, error)
+}
+
+// An InteractiveCommand is a Command that follows up with modals or message
+// components. Their custom IDs must start with CustomIDPrefix and a colon,
+// so that submitting the modals and clicking the components is routed back
+// to HandleInteraction.
+type InteractiveCommand interface {
+	Command
+	CustomIDPrefix() string
+	HandleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) (*discordgo.InteractionResponse, error)
+}
+
+// PrivateContexts lets a command be used in DMs with the bot and in group
+// DMs, as well as in guilds.
+var PrivateContexts = []discordgo.InteractionContextType{
+	discordgo.InteractionContextGuild,
+	discordgo.InteractionContextBotDM,
+	discordgo.InteractionContextPrivateChannel,
+}
+
+// GuildContexts restricts a command to guilds.
+var GuildContexts = []discordgo.InteractionContextType{
+	discordgo.InteractionContextGuild,
+}
+
+// AllIntegrationTypes lets a command be used when the bot is added to a
+// guild as well as when a user adds it to their account, which is needed to
+// use it in group DMs.
+var AllIntegrationTypes = []discordgo.ApplicationIntegrationType{
+	discordgo.ApplicationIntegrationGuildInstall,
+	discordgo.ApplicationIntegrationUserInstall,
 }
@@ -13,7 +13,7 @@ type DeleteFixerCommand struct {
 
 func (c DeleteFixerCommand) ApplicationCommandTemplate() *discordgo.ApplicationCommand {
 	return &discordgo.ApplicationCommand{
-		Name:        "delete-fixer",
+		Name:        "delete",
 		Description: "Delete a fixer for a domain",
 		Options: []*discordgo.ApplicationCommandOption{
 			{
@@ -26,13 +26,17 @@ func (c DeleteFixerCommand) ApplicationCommandTemplate() *discordgo.ApplicationC
 	}
 }
 
-func (c DeleteFixerCommand) Run(i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
-	domain := opts["domain"].(string)
+func (c DeleteFixerCommand) Run(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]any) (string, error) {
+	domain := fixer.ExtractDomain(opts["domain"].(string))
 
-	err := c.Store.Delete(i.GuildID, domain)
+	change, deleted, err := deleteFixer(c.Store, i, domain)
 	if err != nil {
 		return "", fmt.Errorf("deleting fixer failed: %w", err)
 	}
+	if !deleted {
+		return fmt.Sprintf("No fixer found for domain `%v`", domain), nil
+	}
+	announceChanges(s, c.Store, i, change)
 
 	return fmt.Sprintf("Successfully deleted fixer for domain `%v`", domain), nil
 }
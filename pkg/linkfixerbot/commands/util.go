@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// interactionUserID returns the ID of the user who triggered the interaction.
+func interactionUserID(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+// scopeID returns the guild ID fixers are stored under for the interaction:
+// the guild's own ID, or the user's personal scope in DMs and in guilds the
+// bot has not been added to, where it can only be used as a user app.
+//
+// The guild's scope is only used when the guild itself authorized the
+// command, as permission requirements set by the guild do not apply to
+// commands run through the user's own install.
+func scopeID(i *discordgo.InteractionCreate) string {
+	owner, ok := i.AuthorizingIntegrationOwners[discordgo.ApplicationIntegrationGuildInstall]
+	if i.GuildID != "" && ok && owner == i.GuildID {
+		return i.GuildID
+	}
+	return fixer.UserScope(interactionUserID(i))
+}
+
+// messageResponse returns an interaction response with a plain text message.
+func messageResponse(content string) *discordgo.InteractionResponse {
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+		},
+	}
+}
+
+// commandPath returns the full name of the command in the interaction,
+// including any subcommand groups and subcommands, e.g. "fixer add replace".
+// For modal submissions and message components, it is the command that
+// created the message they belong to, if known.
+func commandPath(i *discordgo.InteractionCreate) string {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		if i.Message != nil && i.Message.Interaction != nil {
+			return i.Message.Interaction.Name
+		}
+		return "unknown command"
+	}
+
+	data := i.ApplicationCommandData()
+	path := data.Name
+	opts := data.Options
+	for len(opts) > 0 {
+		opt := opts[0]
+		if opt.Type != discordgo.ApplicationCommandOptionSubCommand && opt.Type != discordgo.ApplicationCommandOptionSubCommandGroup {
+			break
+		}
+		path += " " + opt.Name
+		opts = opt.Options
+	}
+	return path
+}
+
+// ephemeralResponse returns an interaction response with a plain text
+// message that only the user who triggered the interaction can see.
+func ephemeralResponse(content string) *discordgo.InteractionResponse {
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	}
+}
+
+// updateResponse returns an interaction response that replaces the content
+// and components of the message a component belongs to.
+func updateResponse(content string, components []discordgo.MessageComponent) *discordgo.InteractionResponse {
+	if components == nil {
+		// A nil slice would leave the message's existing components in place.
+		components = []discordgo.MessageComponent{}
+	}
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: components,
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+func TestScopeID(t *testing.T) {
+	const otherGuildID = "800000000000000002"
+	user := &discordgo.User{ID: testUserID}
+	member := &discordgo.Member{User: user}
+
+	tests := []struct {
+		name   string
+		i      *discordgo.Interaction
+		owners map[discordgo.ApplicationIntegrationType]string
+		want   string
+	}{
+		{"DM", &discordgo.Interaction{User: user}, map[discordgo.ApplicationIntegrationType]string{
+			discordgo.ApplicationIntegrationUserInstall: testUserID,
+		}, fixer.UserScope(testUserID)},
+		{"GuildInstall", &discordgo.Interaction{GuildID: testGuildID, Member: member}, map[discordgo.ApplicationIntegrationType]string{
+			discordgo.ApplicationIntegrationGuildInstall: testGuildID,
+		}, testGuildID},
+		// The guild has not added the bot, so its permissions cannot be
+		// enforced and the user only gets their personal scope.
+		{"UserInstallInGuild", &discordgo.Interaction{GuildID: testGuildID, Member: member}, map[discordgo.ApplicationIntegrationType]string{
+			discordgo.ApplicationIntegrationUserInstall: testUserID,
+		}, fixer.UserScope(testUserID)},
+		{"BothInstalls", &discordgo.Interaction{GuildID: testGuildID, Member: member}, map[discordgo.ApplicationIntegrationType]string{
+			discordgo.ApplicationIntegrationGuildInstall: testGuildID,
+			discordgo.ApplicationIntegrationUserInstall:  testUserID,
+		}, testGuildID},
+		{"OtherGuildOwner", &discordgo.Interaction{GuildID: testGuildID, Member: member}, map[discordgo.ApplicationIntegrationType]string{
+			discordgo.ApplicationIntegrationGuildInstall: otherGuildID,
+		}, fixer.UserScope(testUserID)},
+		{"NoOwners", &discordgo.Interaction{GuildID: testGuildID, Member: member}, nil, fixer.UserScope(testUserID)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.i.AuthorizingIntegrationOwners = tt.owners
+			if got := scopeID(&discordgo.InteractionCreate{Interaction: tt.i}); got != tt.want {
+				t.Errorf("scopeID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
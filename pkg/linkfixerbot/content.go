@@ -0,0 +1,51 @@
+package linkfixerbot
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// Application flags showing the Message Content intent is enabled for the
+// bot, for verified and unverified bots respectively. discordgo does not
+// define them.
+const (
+	applicationFlagGatewayMessageContent        = 1 << 18
+	applicationFlagGatewayMessageContentLimited = 1 << 19
+)
+
+// checkMessageContentIntent warns if the bot will not be able to read the
+// content of guild messages. If the intent is requested but not enabled for
+// the bot, it is dropped, as Discord would otherwise refuse the connection.
+func (lb *LinkfixerBot) checkMessageContentIntent() error {
+	if !lb.config.MessageContent {
+		log.Warn("the Message Content intent is disabled, so links in server messages will only be fixed when the bot is mentioned. Run with -message-content to enable it")
+		return nil
+	}
+
+	app, err := lb.discord.Application("@me")
+	if err != nil {
+		return fmt.Errorf("could not get application: %w", err)
+	}
+
+	if app.Flags&(applicationFlagGatewayMessageContent|applicationFlagGatewayMessageContentLimited) == 0 {
+		log.Error("the Message Content intent is not enabled for this bot, so links in server messages will only be fixed when the bot is mentioned. Enable it under Bot > Privileged Gateway Intents at https://discord.com/developers/applications/" + app.ID + "/bot, or run with -message-content=false to silence this error")
+		lb.discord.Identify.Intents &^= discordgo.IntentsMessageContent
+	}
+	return nil
+}
+
+// contentWithheld reports whether Discord withheld m's content because the
+// bot lacks the Message Content intent. Messages without the intent arrive
+// with no content, embeds or attachments at all, which a message a user
+// actually sent never has.
+func contentWithheld(m *discordgo.Message) bool {
+	return (m.Type == discordgo.MessageTypeDefault || m.Type == discordgo.MessageTypeReply) &&
+		m.Content == "" &&
+		len(m.Embeds) == 0 &&
+		len(m.Attachments) == 0 &&
+		len(m.StickerItems) == 0 &&
+		len(m.Components) == 0 &&
+		m.Poll == nil
+}
@@ -0,0 +1,39 @@
+package linkfixerbot
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+	"github.com/charmbracelet/log"
+)
+
+func TestContentWithheldWarnsOncePerGuild(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	fd := &fakeDiscord{}
+	lb := newTestBot(t, fd, fixer.GuildSettings{})
+
+	// Messages arrive with no content, embeds or attachments without the
+	// Message Content intent.
+	for _, guildID := range []string{testGuildID, testGuildID, "800000000000000002"} {
+		lb.messageHandler(lb.discord, &discordgo.MessageCreate{Message: &discordgo.Message{
+			ID:        "800000000000000104",
+			ChannelID: testChannelID,
+			GuildID:   guildID,
+			Author:    &discordgo.User{ID: testAuthorID},
+		}})
+	}
+
+	if n := strings.Count(buf.String(), "received a message without content"); n != 2 {
+		t.Errorf("warned %v times for messages in 2 guilds, want 2:\n%v", n, buf.String())
+	}
+	if got := fd.Sent(); len(got) != 0 {
+		t.Errorf("sent %v, want nothing", got)
+	}
+}
@@ -0,0 +1,70 @@
+package linkfixerbot
+
+import (
+	"sync"
+	"time"
+)
+
+// recentFixesSweepInterval is how often expired links are removed from
+// recentFixes.
+const recentFixesSweepInterval = 10 * time.Minute
+
+// recentFixes remembers the fixed links recently posted in each channel, so
+// that reposts of a link are not fixed again.
+type recentFixes struct {
+	mu sync.Mutex
+	// expiries holds when each channel's fixed links are forgotten.
+	expiries  map[string]map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newRecentFixes() *recentFixes {
+	return &recentFixes{
+		expiries: map[string]map[string]time.Time{},
+		now:      time.Now,
+	}
+}
+
+// seen reports whether link was fixed in the channel and has not expired.
+func (rf *recentFixes) seen(channelID string, link string) bool {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	expiry, ok := rf.expiries[channelID][link]
+	return ok && rf.now().Before(expiry)
+}
+
+// add remembers that links were fixed in the channel for ttl.
+func (rf *recentFixes) add(channelID string, ttl time.Duration, links ...string) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	now := rf.now()
+	if now.Sub(rf.lastSweep) > recentFixesSweepInterval {
+		rf.sweep(now)
+	}
+
+	channel, ok := rf.expiries[channelID]
+	if !ok {
+		channel = map[string]time.Time{}
+		rf.expiries[channelID] = channel
+	}
+	for _, link := range links {
+		channel[link] = now.Add(ttl)
+	}
+}
+
+func (rf *recentFixes) sweep(now time.Time) {
+	for channelID, channel := range rf.expiries {
+		for link, expiry := range channel {
+			if !now.Before(expiry) {
+				delete(channel, link)
+			}
+		}
+		if len(channel) == 0 {
+			delete(rf.expiries, channelID)
+		}
+	}
+	rf.lastSweep = now
+}
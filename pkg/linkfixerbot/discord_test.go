@@ -0,0 +1,145 @@
+package linkfixerbot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// Snowflakes used in the recorded events in testdata.
+const (
+	testBotID      = "800000000000000099"
+	testGuildID    = "800000000000000001"
+	testChannelID  = "800000000000000010"
+	testForumPost  = "800000000000000021"
+	testAuthorID   = "800000000000000050"
+	testMutedRole  = "800000000000000070"
+	testTwitterFix = "https://vxtwitter.com/golang/status/1"
+)
+
+// loadEvent decodes the recorded event or API response in testdata/name.json
+// into v.
+func loadEvent(t *testing.T, name string, v any) {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		t.Fatalf("could not read %v: %v", name, err)
+	}
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		t.Fatalf("could not decode %v: %v", name, err)
+	}
+}
+
+// A sentMessage is a message the bot sent to the fake API.
+type sentMessage struct {
+	ChannelID string
+	Content   string
+}
+
+// A fakeDiscord serves recorded responses to the bot's API requests and
+// records the messages it sends.
+type fakeDiscord struct {
+	// responses maps "METHOD path" to the testdata file to respond with.
+	// Paths are relative to the API's base URL.
+	responses map[string]string
+
+	mu   sync.Mutex
+	sent []sentMessage
+}
+
+func (fd *fakeDiscord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v"+discordgo.APIVersion)
+
+	if r.Method == http.MethodPost && strings.HasPrefix(path, "/channels/") && strings.HasSuffix(path, "/messages") {
+		var msg discordgo.MessageSend
+		err := json.NewDecoder(r.Body).Decode(&msg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		channelID := strings.TrimSuffix(strings.TrimPrefix(path, "/channels/"), "/messages")
+		fd.mu.Lock()
+		fd.sent = append(fd.sent, sentMessage{ChannelID: channelID, Content: msg.Content})
+		fd.mu.Unlock()
+
+		_ = json.NewEncoder(w).Encode(discordgo.Message{ID: "1", ChannelID: channelID, Content: msg.Content})
+		return
+	}
+
+	name, ok := fd.responses[r.Method+" "+path]
+	if !ok {
+		http.Error(w, `{"message": "Unknown", "code": 0}`, http.StatusNotFound)
+		return
+	}
+	http.ServeFile(w, r, filepath.Join("testdata", name+".json"))
+}
+
+// Sent returns the messages sent so far.
+func (fd *fakeDiscord) Sent() []sentMessage {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return append([]sentMessage(nil), fd.sent...)
+}
+
+// A redirectTransport sends every request to target instead of its host.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rt.target.Scheme
+	req.URL.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestBot returns a bot whose session talks to fd, with the recorded
+// guild in its state and a fixer for twitter.com in the guild.
+func newTestBot(t *testing.T, fd *fakeDiscord, settings fixer.GuildSettings) *LinkfixerBot {
+	t.Helper()
+
+	srv := httptest.NewServer(fd)
+	t.Cleanup(srv.Close)
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("could not parse server URL: %v", err)
+	}
+
+	store := fixer.NewMemoryStore()
+	_, err = store.Put(testGuildID, "twitter.com", fixer.ReplaceFixer{Old: "twitter.com", New: "vxtwitter.com"}, testAuthorID)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	err = store.PutSettings(testGuildID, settings)
+	if err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+
+	lb, err := NewLinkfixerBot("token", store, Config{})
+	if err != nil {
+		t.Fatalf("NewLinkfixerBot failed: %v", err)
+	}
+	lb.discord.Client = &http.Client{Transport: redirectTransport{target: target}}
+	lb.discord.State.User = &discordgo.User{ID: testBotID}
+
+	var guild discordgo.GuildCreate
+	loadEvent(t, "guild_create", &guild)
+	err = lb.discord.State.OnInterface(lb.discord, &guild)
+	if err != nil {
+		t.Fatalf("could not add guild to state: %v", err)
+	}
+
+	return lb
+}
@@ -0,0 +1,121 @@
+package linkfixerbot
+
+import (
+	"context"
+	"time"
+
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// purgeInterval is how often departed guilds are checked for purging.
+const purgeInterval = time.Hour
+
+// readyHandler marks guilds the bot was removed from while it was offline as
+// departed, as no GuildDelete event is sent for them.
+func (lb *LinkfixerBot) readyHandler(s *discordgo.Session, r *discordgo.Ready) {
+	current := map[string]bool{}
+	for _, g := range r.Guilds {
+		current[g.ID] = true
+	}
+
+	guilds, err := lb.store.Guilds()
+	if err != nil {
+		log.Error("could not list guilds", "err", err)
+		return
+	}
+
+	departed, err := lb.store.Departed()
+	if err != nil {
+		log.Error("could not get departed guilds", "err", err)
+		return
+	}
+
+	for _, guildID := range guilds {
+		if guildID == fixer.GlobalScope || fixer.IsUserScope(guildID) || current[guildID] {
+			continue
+		}
+		if _, ok := departed[guildID]; ok {
+			continue
+		}
+
+		log.Info("guild left while offline", "guildID", guildID)
+		err = lb.store.MarkDeparted(guildID, time.Now())
+		if err != nil {
+			log.Error("could not mark guild as departed", "guildID", guildID, "err", err)
+		}
+	}
+}
+
+func (lb *LinkfixerBot) guildCreateHandler(s *discordgo.Session, g *discordgo.GuildCreate) {
+	err := lb.store.MarkDeparted(g.ID, time.Time{})
+	if err != nil {
+		log.Error("could not clear guild departure", "guildID", g.ID, "err", err)
+	}
+}
+
+func (lb *LinkfixerBot) guildDeleteHandler(s *discordgo.Session, g *discordgo.GuildDelete) {
+	// Guilds also become unavailable during Discord outages, which does not
+	// mean the bot has left them.
+	if g.Unavailable {
+		return
+	}
+
+	log.Info("left guild", "guildID", g.ID)
+	err := lb.store.MarkDeparted(g.ID, time.Now())
+	if err != nil {
+		log.Error("could not mark guild as departed", "guildID", g.ID, "err", err)
+	}
+}
+
+// purgeDepartedGuilds periodically deletes the data of guilds the bot left
+// more than lb.config.GuildRetention ago, until ctx is cancelled.
+func (lb *LinkfixerBot) purgeDepartedGuilds(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		departed, err := lb.store.Departed()
+		if err != nil {
+			log.Error("could not get departed guilds", "err", err)
+		}
+
+		for guildID, at := range departed {
+			if time.Since(at) < lb.config.GuildRetention {
+				continue
+			}
+
+			err = lb.store.Purge(guildID)
+			if err != nil {
+				log.Error("could not purge departed guild", "guildID", guildID, "err", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// addApplicationOwners adds the owners of the bot's application to its
+// operators.
+func (lb *LinkfixerBot) addApplicationOwners() error {
+	app, err := lb.discord.Application("@me")
+	if err != nil {
+		return err
+	}
+
+	if app.Owner != nil {
+		lb.operators.Add(app.Owner.ID)
+	}
+	if app.Team != nil {
+		for _, member := range app.Team.Members {
+			lb.operators.Add(member.User.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package linkfixerbot
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+func TestReadyMarksGuildsLeftWhileOffline(t *testing.T) {
+	lb := newTestBot(t, &fakeDiscord{}, fixer.GuildSettings{})
+
+	// The bot left a guild that only changed its settings, and a user has
+	// personal settings, which are never departed.
+	const leftGuildID = "800000000000000002"
+	err := lb.store.PutSettings(leftGuildID, fixer.GuildSettings{FixBotMessages: true})
+	if err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+	err = lb.store.PutSettings(fixer.UserScope(testAuthorID), fixer.GuildSettings{FixBotMessages: true})
+	if err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+
+	lb.readyHandler(lb.discord, &discordgo.Ready{Guilds: []*discordgo.Guild{{ID: testGuildID}}})
+
+	departed, err := lb.store.Departed()
+	if err != nil {
+		t.Fatalf("Departed failed: %v", err)
+	}
+	var got []string
+	for guildID := range departed {
+		got = append(got, guildID)
+	}
+	if want := []string{leftGuildID}; !slices.Equal(got, want) {
+		t.Errorf("departed guilds = %v, want %v", got, want)
+	}
+}
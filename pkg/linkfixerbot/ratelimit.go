@@ -0,0 +1,97 @@
+package linkfixerbot
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiterSweepInterval is how often full buckets, which behave the same
+// as missing ones, are removed from a rateLimiter.
+const rateLimiterSweepInterval = 10 * time.Minute
+
+// A rateLimit is a token bucket limit of perMinute tokens per minute, with a
+// burst of up to perMinute tokens. Negative limits are unlimited.
+type rateLimit struct {
+	key       string
+	perMinute int
+}
+
+// A tokenBucket holds the tokens left for one key, as of last.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// A rateLimiter keeps token buckets for arbitrary keys, such as channels,
+// users and guilds.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets: map[string]*tokenBucket{},
+		now:     time.Now,
+	}
+}
+
+// take takes up to n tokens from the buckets of every limit in limits, and
+// returns how many it took. The same number is taken from each bucket, so no
+// limit is ever exceeded.
+func (rl *rateLimiter) take(n int, limits ...rateLimit) int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	if now.Sub(rl.lastSweep) > rateLimiterSweepInterval {
+		rl.sweep(now)
+	}
+
+	taken := n
+	var buckets []*tokenBucket
+	for _, limit := range limits {
+		if limit.perMinute < 0 {
+			continue
+		}
+
+		b := rl.refill(limit, now)
+		taken = min(taken, int(b.tokens))
+		buckets = append(buckets, b)
+	}
+
+	for _, b := range buckets {
+		b.tokens -= float64(taken)
+	}
+	return taken
+}
+
+// refill returns the bucket for limit with the tokens accumulated since it
+// was last used added.
+func (rl *rateLimiter) refill(limit rateLimit, now time.Time) *tokenBucket {
+	capacity := float64(limit.perMinute)
+
+	b, ok := rl.buckets[limit.key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, last: now}
+		rl.buckets[limit.key] = b
+		return b
+	}
+
+	b.tokens = min(capacity, b.tokens+now.Sub(b.last).Minutes()*capacity)
+	b.last = now
+	return b
+}
+
+// sweep removes buckets that have not been used for long enough to have
+// refilled, whatever their limit.
+func (rl *rateLimiter) sweep(now time.Time) {
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) > time.Minute {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
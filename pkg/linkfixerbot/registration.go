@@ -0,0 +1,175 @@
+package linkfixerbot
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// registerCommands makes the registered commands match the command templates,
+// only uploading commands that are new or have changed, and deleting
+// commands that no longer exist.
+func (lb *LinkfixerBot) registerCommands() error {
+	appID := lb.discord.State.Application.ID
+	guildID := lb.config.DevGuildID
+
+	existing, err := lb.discord.ApplicationCommands(appID, guildID)
+	if err != nil {
+		return fmt.Errorf("could not get registered commands: %w", err)
+	}
+
+	existingByName := map[string]*discordgo.ApplicationCommand{}
+	for _, command := range existing {
+		existingByName[command.Name] = command
+	}
+
+	var registeredCommands []*discordgo.ApplicationCommand
+	for name, command := range lb.commands {
+		template := command.ApplicationCommandTemplate()
+
+		if current, ok := existingByName[name]; ok && commandsEqual(template, current) {
+			log.Debug("command unchanged", "commandName", name)
+			registeredCommands = append(registeredCommands, current)
+			continue
+		}
+
+		// Creating a command with the name of an existing one updates it.
+		registered, err := lb.discord.ApplicationCommandCreate(appID, guildID, template)
+		if err != nil {
+			return fmt.Errorf("could not register command %v: %w", name, err)
+		}
+		log.Info("registered command", "commandName", name, "guildID", guildID)
+		registeredCommands = append(registeredCommands, registered)
+	}
+
+	for name, command := range existingByName {
+		if _, ok := lb.commands[name]; ok {
+			continue
+		}
+
+		err = lb.discord.ApplicationCommandDelete(appID, guildID, command.ID)
+		if err != nil {
+			return fmt.Errorf("could not delete stale command %v: %w", name, err)
+		}
+		log.Info("deleted stale command", "commandName", name, "guildID", guildID)
+	}
+
+	log.Info("successfully registered commands", "numRegistered", len(registeredCommands), "guildID", guildID)
+	lb.registeredCommands = registeredCommands
+	return nil
+}
+
+func (lb *LinkfixerBot) deleteCommands() error {
+	for _, command := range lb.registeredCommands {
+		err := lb.discord.ApplicationCommandDelete(lb.discord.State.Application.ID, lb.config.DevGuildID, command.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultIntegrationTypes and defaultContexts are what Discord fills in for
+// global commands registered without integration types or contexts.
+var (
+	defaultIntegrationTypes = []discordgo.ApplicationIntegrationType{
+		discordgo.ApplicationIntegrationGuildInstall,
+	}
+	defaultContexts = []discordgo.InteractionContextType{
+		discordgo.InteractionContextGuild,
+		discordgo.InteractionContextBotDM,
+		discordgo.InteractionContextPrivateChannel,
+	}
+)
+
+// commandsEqual reports whether the fields of a command that we set in
+// templates match those of a registered command.
+func commandsEqual(a *discordgo.ApplicationCommand, b *discordgo.ApplicationCommand) bool {
+	return commandType(a) == commandType(b) &&
+		a.Name == b.Name &&
+		a.Description == b.Description &&
+		maps.Equal(derefOrZero(a.NameLocalizations), derefOrZero(b.NameLocalizations)) &&
+		maps.Equal(derefOrZero(a.DescriptionLocalizations), derefOrZero(b.DescriptionLocalizations)) &&
+		permissions(a) == permissions(b) &&
+		derefOr(a.NSFW, false) == derefOr(b.NSFW, false) &&
+		slices.Equal(sortedOr(a.Contexts, defaultContexts), sortedOr(b.Contexts, defaultContexts)) &&
+		slices.Equal(sortedOr(a.IntegrationTypes, defaultIntegrationTypes), sortedOr(b.IntegrationTypes, defaultIntegrationTypes)) &&
+		optionsEqual(a.Options, b.Options)
+}
+
+// commandType returns the type of c, which Discord defaults to a chat input
+// command when unset.
+func commandType(c *discordgo.ApplicationCommand) discordgo.ApplicationCommandType {
+	if c.Type == 0 {
+		return discordgo.ChatApplicationCommand
+	}
+	return c.Type
+}
+
+func permissions(c *discordgo.ApplicationCommand) int64 {
+	if c.DefaultMemberPermissions == nil {
+		return -1
+	}
+	return *c.DefaultMemberPermissions
+}
+
+// derefOrZero returns *p, or the zero value if p is nil.
+func derefOrZero[T any](p *T) T {
+	var zero T
+	return derefOr(p, zero)
+}
+
+// derefOr returns *p, or def if p is nil.
+func derefOr[T any](p *T, def T) T {
+	if p == nil {
+		return def
+	}
+	return *p
+}
+
+// ptrEqual reports whether a and b are both nil, or point to equal values.
+func ptrEqual[T comparable](a *T, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// sortedOr returns a sorted copy of *p, or def if p is nil or empty, as
+// Discord does not keep the order of, or distinguish between nil and empty,
+// integration types and contexts.
+func sortedOr[T cmp.Ordered](p *[]T, def []T) []T {
+	if p == nil || len(*p) == 0 {
+		return def
+	}
+	return slices.Sorted(slices.Values(*p))
+}
+
+func optionsEqual(a []*discordgo.ApplicationCommandOption, b []*discordgo.ApplicationCommandOption) bool {
+	return slices.EqualFunc(a, b, func(a *discordgo.ApplicationCommandOption, b *discordgo.ApplicationCommandOption) bool {
+		return a.Type == b.Type &&
+			a.Name == b.Name &&
+			a.Description == b.Description &&
+			maps.Equal(a.NameLocalizations, b.NameLocalizations) &&
+			maps.Equal(a.DescriptionLocalizations, b.DescriptionLocalizations) &&
+			a.Required == b.Required &&
+			a.Autocomplete == b.Autocomplete &&
+			ptrEqual(a.MinValue, b.MinValue) &&
+			a.MaxValue == b.MaxValue &&
+			ptrEqual(a.MinLength, b.MinLength) &&
+			a.MaxLength == b.MaxLength &&
+			slices.Equal(a.ChannelTypes, b.ChannelTypes) &&
+			slices.EqualFunc(a.Choices, b.Choices, func(a *discordgo.ApplicationCommandOptionChoice, b *discordgo.ApplicationCommandOptionChoice) bool {
+				// Registered choice values are decoded from JSON, so compare
+				// them by their formatted value rather than their type.
+				return a.Name == b.Name &&
+					maps.Equal(a.NameLocalizations, b.NameLocalizations) &&
+					fmt.Sprint(a.Value) == fmt.Sprint(b.Value)
+			}) &&
+			optionsEqual(a.Options, b.Options)
+	})
+}
@@ -0,0 +1,105 @@
+package linkfixerbot
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// registeredCommand returns template as Discord returns it once registered:
+// decoded from JSON, with an ID and with the defaults for any integration
+// types and contexts it left out.
+func registeredCommand(t *testing.T, template *discordgo.ApplicationCommand) *discordgo.ApplicationCommand {
+	t.Helper()
+
+	b, err := json.Marshal(template)
+	if err != nil {
+		t.Fatalf("could not encode command: %v", err)
+	}
+	var registered discordgo.ApplicationCommand
+	err = json.Unmarshal(b, &registered)
+	if err != nil {
+		t.Fatalf("could not decode command: %v", err)
+	}
+
+	registered.ID = "800000000000000200"
+	registered.Version = "800000000000000201"
+	if registered.IntegrationTypes == nil {
+		registered.IntegrationTypes = &[]discordgo.ApplicationIntegrationType{discordgo.ApplicationIntegrationGuildInstall}
+	}
+	if registered.Contexts == nil {
+		registered.Contexts = &[]discordgo.InteractionContextType{
+			discordgo.InteractionContextGuild,
+			discordgo.InteractionContextBotDM,
+			discordgo.InteractionContextPrivateChannel,
+		}
+	}
+	return &registered
+}
+
+func TestCommandsEqualUnchanged(t *testing.T) {
+	lb, err := NewLinkfixerBot("token", fixer.NewMemoryStore(), Config{})
+	if err != nil {
+		t.Fatalf("NewLinkfixerBot failed: %v", err)
+	}
+
+	for name, command := range lb.commands {
+		t.Run(name, func(t *testing.T) {
+			template := command.ApplicationCommandTemplate()
+			if !commandsEqual(template, registeredCommand(t, template)) {
+				t.Errorf("command %v differs from its registered copy", name)
+			}
+		})
+	}
+}
+
+func TestCommandsEqualChanged(t *testing.T) {
+	minLength := 1
+	template := func() *discordgo.ApplicationCommand {
+		return &discordgo.ApplicationCommand{
+			Name:        "test",
+			Description: "Test",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "value",
+				Description: "Value",
+				MinLength:   &minLength,
+				MaxLength:   100,
+			}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *discordgo.ApplicationCommand)
+	}{
+		{"Description", func(c *discordgo.ApplicationCommand) { c.Description = "Other" }},
+		{"Localizations", func(c *discordgo.ApplicationCommand) {
+			c.DescriptionLocalizations = &map[discordgo.Locale]string{discordgo.French: "Essai"}
+		}},
+		{"Contexts", func(c *discordgo.ApplicationCommand) {
+			c.Contexts = &[]discordgo.InteractionContextType{discordgo.InteractionContextGuild}
+		}},
+		{"OptionMaxLength", func(c *discordgo.ApplicationCommand) { c.Options[0].MaxLength = 50 }},
+		{"OptionMinLength", func(c *discordgo.ApplicationCommand) { c.Options[0].MinLength = nil }},
+		{"OptionMinValue", func(c *discordgo.ApplicationCommand) {
+			minValue := 0.0
+			c.Options[0].MinValue = &minValue
+		}},
+		{"OptionLocalizations", func(c *discordgo.ApplicationCommand) {
+			c.Options[0].NameLocalizations = map[discordgo.Locale]string{discordgo.French: "valeur"}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registered := registeredCommand(t, template())
+			changed := template()
+			tt.change(changed)
+			if commandsEqual(changed, registered) {
+				t.Errorf("commandsEqual did not notice the change")
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package linkfixerbot
+
+import (
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// ignoreReason returns why links in m should not be fixed under the guild's
+// settings, or "" if they should be.
+func ignoreReason(m *discordgo.Message, settings fixer.GuildSettings) string {
+	// Only fix messages written by someone, not system messages such as
+	// pins, joins or thread starters.
+	if m.Type != discordgo.MessageTypeDefault && m.Type != discordgo.MessageTypeReply {
+		return "system message"
+	}
+
+	// Webhook messages have bot authors too, so check for them first.
+	if m.WebhookID != "" {
+		if !settings.FixWebhookMessages {
+			return "webhook message"
+		}
+	} else if m.Author.Bot && !settings.FixBotMessages {
+		return "bot author"
+	}
+
+	if slices.Contains(settings.IgnoredUserIDs, m.Author.ID) {
+		return "ignored user"
+	}
+
+	if m.Member != nil {
+		for _, roleID := range m.Member.Roles {
+			if slices.Contains(settings.IgnoredRoleIDs, roleID) {
+				return "ignored role"
+			}
+		}
+	}
+
+	return ""
+}
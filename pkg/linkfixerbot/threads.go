@@ -0,0 +1,126 @@
+package linkfixerbot
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/charmbracelet/log"
+)
+
+// A channelInfo describes the channel a message was posted in.
+type channelInfo struct {
+	Channel *discordgo.Channel
+	// Parent is the channel or forum a thread belongs to. It is nil if
+	// Channel is not a thread.
+	Parent *discordgo.Channel
+}
+
+// IsForumPost reports whether the channel is a post in a forum or media
+// channel.
+func (c channelInfo) IsForumPost() bool {
+	return c.Parent != nil && (c.Parent.Type == discordgo.ChannelTypeGuildForum || c.Parent.Type == discordgo.ChannelTypeGuildMedia)
+}
+
+// IsLocked reports whether the channel is a locked thread, which the bot
+// cannot post in.
+func (c channelInfo) IsLocked() bool {
+	return c.Channel.ThreadMetadata != nil && c.Channel.ThreadMetadata.Locked
+}
+
+// LimitChannelID returns the ID of the channel whose rate limits apply to
+// messages in the channel: its parent if it is a thread, so that starting
+// threads does not get around them. Messages outside of guilds have no
+// channelInfo, so their channelID is returned.
+func (c channelInfo) LimitChannelID(channelID string) string {
+	if c.Parent != nil {
+		return c.Parent.ID
+	}
+	return channelID
+}
+
+// resolveChannel looks up a channel, and its parent if it is a thread,
+// preferring the state cache to the API.
+func resolveChannel(s *discordgo.Session, channelID string) (channelInfo, error) {
+	channel, err := lookupChannel(s, channelID)
+	if err != nil {
+		return channelInfo{}, err
+	}
+
+	info := channelInfo{Channel: channel}
+	if channel.IsThread() && channel.ParentID != "" {
+		info.Parent, err = lookupChannel(s, channel.ParentID)
+		if err != nil {
+			return channelInfo{}, fmt.Errorf("could not get parent of thread %v: %w", channelID, err)
+		}
+	}
+	return info, nil
+}
+
+// lookupMember looks up a member of a guild, preferring the state cache to
+// the API.
+func lookupMember(s *discordgo.Session, guildID string, userID string) (*discordgo.Member, error) {
+	member, err := s.State.Member(guildID, userID)
+	if err == nil {
+		return member, nil
+	}
+
+	member, err = s.GuildMember(guildID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get member %v of guild %v: %w", userID, guildID, err)
+	}
+	return member, nil
+}
+
+func lookupChannel(s *discordgo.Session, channelID string) (*discordgo.Channel, error) {
+	channel, err := s.State.Channel(channelID)
+	if err == nil {
+		return channel, nil
+	}
+
+	channel, err = s.Channel(channelID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get channel %v: %w", channelID, err)
+	}
+	return channel, nil
+}
+
+// threadCreateHandler fixes the links in the starter message of new forum
+// posts. The fixed links are posted in the thread, leaving the post's title
+// and starter message untouched.
+func (lb *LinkfixerBot) threadCreateHandler(s *discordgo.Session, t *discordgo.ThreadCreate) {
+	if !t.NewlyCreated {
+		return
+	}
+
+	info, err := resolveChannel(s, t.ID)
+	if err != nil {
+		log.Error("could not resolve thread", "threadID", t.ID, "err", err)
+		return
+	}
+	if !info.IsForumPost() {
+		return
+	}
+
+	// A forum post's starter message has the same ID as the thread.
+	m, err := s.ChannelMessage(t.ID, t.ID)
+	if err != nil {
+		log.Error("could not get forum post starter message", "threadID", t.ID, "parentID", t.ParentID, "err", err)
+		return
+	}
+	if m.Author == nil || m.Author.ID == s.State.User.ID {
+		return
+	}
+
+	// Messages fetched from the API do not have their guild ID or member
+	// set, and the member's roles are needed for the guild's role rules.
+	// Webhooks are not members.
+	m.GuildID = t.GuildID
+	if m.WebhookID == "" {
+		m.Member, err = lookupMember(s, t.GuildID, m.Author.ID)
+		if err != nil {
+			log.Error("could not get forum post author", "threadID", t.ID, "userID", m.Author.ID, "err", err)
+			return
+		}
+	}
+	lb.fixMessage(s, m, info)
+}
@@ -0,0 +1,148 @@
+package linkfixerbot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/carreter/discord-linkfixer-bot/pkg/fixer"
+)
+
+// testForumPost2 is a second forum post in the same forum, linking the same
+// URL as testForumPost.
+const testForumPost2 = "800000000000000022"
+
+// forumPostResponses serve the starter messages of the recorded forum posts
+// and their author, who has the muted role.
+var forumPostResponses = map[string]string{
+	"GET /channels/" + testForumPost + "/messages/" + testForumPost:   "forum_post_starter_message",
+	"GET /channels/" + testForumPost2 + "/messages/" + testForumPost2: "forum_post_2_starter_message",
+	"GET /guilds/" + testGuildID + "/members/" + testAuthorID:         "member",
+}
+
+// createForumPost delivers the recorded creation of a forum post to lb, the
+// way the gateway does: the state sees it before the handlers.
+func createForumPost(t *testing.T, lb *LinkfixerBot) {
+	createRecordedForumPost(t, lb, "thread_create_forum_post")
+}
+
+// createRecordedForumPost delivers the recorded creation of a forum post in
+// testdata/name.json to lb, as createForumPost does.
+func createRecordedForumPost(t *testing.T, lb *LinkfixerBot, name string) {
+	var tc discordgo.ThreadCreate
+	loadEvent(t, name, &tc)
+	err := lb.discord.State.OnInterface(lb.discord, &tc)
+	if err != nil {
+		t.Fatalf("could not add thread to state: %v", err)
+	}
+	lb.threadCreateHandler(lb.discord, &tc)
+}
+
+func TestThreadCreateFixesForumPost(t *testing.T) {
+	fd := &fakeDiscord{responses: forumPostResponses}
+	lb := newTestBot(t, fd, fixer.GuildSettings{})
+
+	createForumPost(t, lb)
+
+	want := []sentMessage{{ChannelID: testForumPost, Content: testTwitterFix}}
+	if got := fd.Sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+}
+
+func TestThreadCreateAppliesRoleRules(t *testing.T) {
+	fd := &fakeDiscord{responses: forumPostResponses}
+	lb := newTestBot(t, fd, fixer.GuildSettings{IgnoredRoleIDs: []string{testMutedRole}})
+
+	createForumPost(t, lb)
+
+	if got := fd.Sent(); len(got) != 0 {
+		t.Errorf("sent %v for a post by a member with an ignored role, want nothing", got)
+	}
+}
+
+func TestThreadCreateSkipsPostWithoutMember(t *testing.T) {
+	// Without the member, role rules cannot be checked, so the post is
+	// left alone.
+	fd := &fakeDiscord{responses: map[string]string{
+		"GET /channels/" + testForumPost + "/messages/" + testForumPost: "forum_post_starter_message",
+	}}
+	lb := newTestBot(t, fd, fixer.GuildSettings{})
+
+	createForumPost(t, lb)
+
+	if got := fd.Sent(); len(got) != 0 {
+		t.Errorf("sent %v for a post whose author could not be found, want nothing", got)
+	}
+}
+
+// postInThreads delivers the recorded messages in two threads of the same
+// channel to lb.
+func postInThreads(t *testing.T, lb *LinkfixerBot) {
+	for _, name := range []string{"message_create_thread_1", "message_create_thread_2"} {
+		var mc discordgo.MessageCreate
+		loadEvent(t, name, &mc)
+		lb.messageHandler(lb.discord, &mc)
+	}
+}
+
+func TestThreadMessagesDedupedPerThread(t *testing.T) {
+	fd := &fakeDiscord{}
+	lb := newTestBot(t, fd, fixer.GuildSettings{DuplicateWindow: time.Hour})
+
+	postInThreads(t, lb)
+
+	// Each thread is its own conversation, so the same link in a second
+	// thread of the channel is not a repost.
+	want := []sentMessage{
+		{ChannelID: "800000000000000011", Content: testTwitterFix},
+		{ChannelID: "800000000000000012", Content: testTwitterFix},
+	}
+	if got := fd.Sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+
+	// Posting the link again in a thread is.
+	postInThreads(t, lb)
+	if got := fd.Sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v after reposting, want %v", got, want)
+	}
+}
+
+func TestForumPostsWithSameLinkBothFixed(t *testing.T) {
+	fd := &fakeDiscord{responses: forumPostResponses}
+	lb := newTestBot(t, fd, fixer.GuildSettings{DuplicateWindow: time.Hour})
+
+	createRecordedForumPost(t, lb, "thread_create_forum_post")
+	createRecordedForumPost(t, lb, "thread_create_forum_post_2")
+
+	want := []sentMessage{
+		{ChannelID: testForumPost, Content: testTwitterFix},
+		{ChannelID: testForumPost2, Content: testTwitterFix},
+	}
+	if got := fd.Sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+}
+
+func TestThreadMessagesRateLimitedOnParent(t *testing.T) {
+	fd := &fakeDiscord{}
+	lb := newTestBot(t, fd, fixer.GuildSettings{
+		ChannelFixesPerMinute: 1,
+		DuplicateWindow:       -1,
+	})
+
+	postInThreads(t, lb)
+
+	// Both threads share their channel's limit of one fix a minute.
+	want := []sentMessage{{ChannelID: "800000000000000011", Content: testTwitterFix}}
+	if got := fd.Sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+
+	// Messages in the channel itself share the limit too.
+	if got := lb.limiter.take(1, rateLimit{key: "channel:" + testChannelID, perMinute: 1}); got != 0 {
+		t.Errorf("channel had %v fixes left, want 0", got)
+	}
+}